@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+// columnType is the type of a csv column.
+// Cells are converted to the Go value of the type: string, int32, int64, float32, float64, bool or time.Time.
+type columnType struct {
+	name string
+	// multi splits a cell into multi-values by the separator
+	multi bool
+}
+
+var columnTypeNames = []string{"string", "int", "long", "float", "double", "bool", "date"}
+
+// parseColumnType parses a type name such as "int" or "string[]".
+func parseColumnType(s string) (columnType, error) {
+	name, multi := strings.CutSuffix(s, "[]")
+	if !slices.Contains(columnTypeNames, name) {
+		return columnType{}, fmt.Errorf("unknown column type: %q", s)
+	}
+	return columnType{name: name, multi: multi}, nil
+}
+
+// parseColumn parses a column such as "price:int" into its name and type.
+// A column without a type annotation is a string column.
+func parseColumn(column string) (string, columnType, bool, error) {
+	name, typ, ok := strings.Cut(column, ":")
+	if !ok {
+		return column, columnType{name: "string"}, false, nil
+	}
+	t, err := parseColumnType(typ)
+	if err != nil {
+		return "", columnType{}, false, fmt.Errorf("column %q: %w", column, err)
+	}
+	return name, t, true, nil
+}
+
+// convert converts a cell to the value of the type.
+// An empty cell of a non-string scalar column is missing, and ok is false.
+func (t columnType) convert(value, separator string) (v interface{}, ok bool, err error) {
+	if t.multi {
+		if value == "" {
+			return []interface{}{}, true, nil
+		}
+		values := strings.Split(value, separator)
+		ret := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			v, err := t.convertScalar(value)
+			if err != nil {
+				return nil, false, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, true, nil
+	}
+
+	if value == "" && t.name != "string" {
+		return nil, false, nil
+	}
+	v, err = t.convertScalar(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (t columnType) convertScalar(value string) (interface{}, error) {
+	switch t.name {
+	case "int":
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return int32(i), nil
+	case "long":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, err
+		}
+		return float32(f), nil
+	case "double":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "date":
+		return parseDate(value)
+	default:
+		return value, nil
+	}
+}
+
+// dateLayouts are the accepted layouts of date cells.
+// Dates without a time zone are UTC.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+// parseDate parses a date cell.
+// Date math expressions such as "NOW/DAY" are passed to Solr as solr.DateMath.
+func parseDate(value string) (interface{}, error) {
+	if solr.IsDateMath(value) {
+		return solr.DateMath(value), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid date: %q", value)
+}
+
+// loadColumnTypes loads a column spec file.
+// Each line is a column with a type annotation such as "price:int".
+// Blank lines and lines starting with "#" are ignored.
+// It returns nil if the file is not specified.
+func loadColumnTypes(fileName string) (map[string]columnType, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	types := make(map[string]columnType)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		column := strings.TrimSpace(scanner.Text())
+		if column == "" || strings.HasPrefix(column, "#") {
+			continue
+		}
+		name, t, ok, err := parseColumn(column)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fileName, line, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: column %q has no type", fileName, line, column)
+		}
+		types[name] = t
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+type csvOptions struct {
+	// columnTypes are the types of columns without type annotations in the header
+	columnTypes map[string]columnType
+	// multiValuedFields are split into multi-values by separator
+	multiValuedFields []string
+	separator         string
+}
+
+// columnType returns the type of the column.
+// The type annotation in the header has priority over the column spec.
+func (o csvOptions) columnType(column string) (string, columnType, error) {
+	name, t, ok, err := parseColumn(column)
+	if err != nil {
+		return "", columnType{}, err
+	}
+	if !ok {
+		if spec, found := o.columnTypes[name]; found {
+			t = spec
+		}
+	}
+	if slices.Contains(o.multiValuedFields, name) {
+		t.multi = true
+	}
+	return name, t, nil
+}
+
+// parseCSV parses all rows of the csv into documents.
+// Conversion errors of all rows are joined with their line numbers.
+func parseCSV(in io.Reader, opts csvOptions) ([]solr.Document, error) {
+	reader := csv.NewReader(in)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(header))
+	types := make([]columnType, len(header))
+	for i, column := range header {
+		if names[i], types[i], err = opts.columnType(column); err != nil {
+			return nil, err
+		}
+	}
+
+	// extract "ID"
+	idIndex := -1
+	for i, field := range names {
+		if strings.ToUpper(field) == "ID" {
+			idIndex = i
+		}
+	}
+	if idIndex == -1 {
+		return nil, errors.New("csv should contains id field")
+	}
+
+	docs := make([]solr.Document, 0)
+	var errs []error
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		doc := solr.Document{
+			Fields: make([]solr.Field, 0, len(record)),
+		}
+		for i, field := range record {
+			if i == idIndex {
+				doc.ID = field
+				continue
+			}
+			value, ok, err := types[i].convert(field, opts.separator)
+			if err != nil {
+				line, _ := reader.FieldPos(i)
+				errs = append(errs, fmt.Errorf("line %d: column %q: %w", line, names[i], err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			doc.Fields = append(doc.Fields, solr.Field{
+				Key:   names[i],
+				Value: value,
+			})
+		}
+		docs = append(docs, doc)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return docs, nil
+}
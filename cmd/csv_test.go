@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestParseCSV(t *testing.T) {
+	cases := []struct {
+		name     string
+		csv      string
+		opts     csvOptions
+		expected []solr.Document
+	}{
+		{
+			name: "no annotations",
+			csv:  "id,title,count\n1,foo,10\n",
+			expected: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "title", Value: "foo"}, {Key: "count", Value: "10"}}},
+			},
+		},
+		{
+			name: "header annotations",
+			csv: "id,count:int,total:long,ratio:float,score:double,flag:bool,tags:string[],created_at:date\n" +
+				"1,10,20,1.1,2.5,true,a|b,2024-01-02T03:04:05Z\n",
+			opts: csvOptions{separator: "|"},
+			expected: []solr.Document{
+				{ID: "1", Fields: []solr.Field{
+					{Key: "count", Value: int32(10)},
+					{Key: "total", Value: int64(20)},
+					{Key: "ratio", Value: float32(1.1)},
+					{Key: "score", Value: 2.5},
+					{Key: "flag", Value: true},
+					{Key: "tags", Value: []interface{}{"a", "b"}},
+					{Key: "created_at", Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+				}},
+			},
+		},
+		{
+			name: "empty cells",
+			csv:  "id,count:int,title,tags:string[]\n1,,,\n",
+			opts: csvOptions{separator: "|"},
+			expected: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "title", Value: ""}, {Key: "tags", Value: []interface{}{}}}},
+			},
+		},
+		{
+			name: "date math and date only",
+			csv:  "id,expire_at:date,day:date\n1,NOW/DAY+7DAYS,2024-01-02\n",
+			expected: []solr.Document{
+				{ID: "1", Fields: []solr.Field{
+					{Key: "expire_at", Value: solr.DateMath("NOW/DAY+7DAYS")},
+					{Key: "day", Value: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+				}},
+			},
+		},
+		{
+			name: "column spec",
+			csv:  "id,count,nums,title:string\n1,10,1;2,foo\n",
+			opts: csvOptions{
+				columnTypes: map[string]columnType{
+					"count": {name: "long"},
+					"nums":  {name: "int", multi: true},
+					"title": {name: "int"},
+				},
+				separator: ";",
+			},
+			expected: []solr.Document{
+				{ID: "1", Fields: []solr.Field{
+					{Key: "count", Value: int64(10)},
+					{Key: "nums", Value: []interface{}{int32(1), int32(2)}},
+					{Key: "title", Value: "foo"},
+				}},
+			},
+		},
+		{
+			name: "multi-valued fields",
+			csv:  "id,tags,nums:int\n1,a|b,1|2\n",
+			opts: csvOptions{multiValuedFields: []string{"tags", "nums"}, separator: "|"},
+			expected: []solr.Document{
+				{ID: "1", Fields: []solr.Field{
+					{Key: "tags", Value: []interface{}{"a", "b"}},
+					{Key: "nums", Value: []interface{}{int32(1), int32(2)}},
+				}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseCSV(strings.NewReader(c.csv), c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCSV_Errors(t *testing.T) {
+	cases := []struct {
+		name     string
+		csv      string
+		expected []string
+	}{
+		{
+			name:     "unknown type",
+			csv:      "id,count:integer\n1,10\n",
+			expected: []string{`column "count:integer": unknown column type: "integer"`},
+		},
+		{
+			name:     "no id",
+			csv:      "title\nfoo\n",
+			expected: []string{"csv should contains id field"},
+		},
+		{
+			name: "conversion errors",
+			csv:  "id,count:int,flag:bool,created_at:date\n1,10,true,2024-01-02\n2,x,true,2024-01-02\n3,10,yes,2024-13-01\n",
+			expected: []string{
+				`line 3: column "count": strconv.ParseInt: parsing "x": invalid syntax`,
+				`line 4: column "flag": strconv.ParseBool: parsing "yes": invalid syntax`,
+				`line 4: column "created_at": invalid date: "2024-13-01"`,
+			},
+		},
+		{
+			name:     "out of range",
+			csv:      "id,count:int\n1,3000000000\n",
+			expected: []string{`line 2: column "count": strconv.ParseInt: parsing "3000000000": value out of range`},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			docs, err := parseCSV(strings.NewReader(c.csv), csvOptions{separator: "|"})
+			if err == nil {
+				t.Fatalf("expected error, but got %+v", docs)
+			}
+			if diff := cmp.Diff(c.expected, strings.Split(err.Error(), "\n")); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadColumnTypes(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     string
+		expected map[string]columnType
+		wantErr  string
+	}{
+		{
+			name: "column spec",
+			spec: "# types\nprice:int\n\n  tags:string[]  \ncreated_at:date\n",
+			expected: map[string]columnType{
+				"price":      {name: "int"},
+				"tags":       {name: "string", multi: true},
+				"created_at": {name: "date"},
+			},
+		},
+		{
+			name:    "no type",
+			spec:    "price:int\ntitle\n",
+			wantErr: `:2: column "title" has no type`,
+		},
+		{
+			name:    "unknown type",
+			spec:    "price:money\n",
+			wantErr: `:1: column "price:money": unknown column type: "money"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "columns.txt")
+			if err := os.WriteFile(fileName, []byte(c.spec), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadColumnTypes(fileName)
+			if c.wantErr != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), c.wantErr) {
+					t.Fatalf("expected error %q, but got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got, cmp.AllowUnexported(columnType{})); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+// readIDs reads ids, one per line. Blank lines are ignored.
+func readIDs(in io.Reader) ([]string, error) {
+	ids := make([]string, 0)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// deleteCmd represents the delete command
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "delete documents by ids or queries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sc := solr.NewClient(solrHost, collection)
+
+		if deleteIDsFile == "" && len(deleteQueries) == 0 {
+			return errors.New("--ids or --query is required")
+		}
+		if (deleteRoute != "" || deleteVersion != 0) && len(deleteQueries) == 0 {
+			return errors.New("--route and --version are options of --query")
+		}
+
+		encoder, err := newEncoder()
+		if err != nil {
+			return err
+		}
+		builder := solr.NewUpdateBatchBuilder(nil, nil)
+		builder.SetEncoder(encoder)
+
+		if deleteIDsFile != "" {
+			in, err := openFile(deleteIDsFile)
+			if err != nil {
+				return err
+			}
+			ids, err := readIDs(in)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				builder.Delete(solr.Document{ID: id})
+			}
+			fmt.Printf("delete %d ids\n", len(builder.DeleteDocuments))
+		}
+		for _, query := range deleteQueries {
+			builder.DeleteByQuery(solr.DeleteQuery{
+				Query:   query,
+				Route:   deleteRoute,
+				Version: deleteVersion,
+			})
+		}
+
+		updateOpts, err := updateOptions(cmd)
+		if err != nil {
+			return err
+		}
+		if _, err := send(sc, builder, updateOpts); err != nil {
+			return err
+		}
+		return commitAtEnd(sc, updateOpts)
+	},
+}
+
+var (
+	deleteIDsFile string
+	deleteQueries = []string{}
+	deleteRoute   string
+	deleteVersion int64
+)
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.PersistentFlags().StringVar(&deleteIDsFile, "ids", "", `file of ids to delete, one per line ("-" for stdin)`)
+	deleteCmd.PersistentFlags().StringArrayVarP(&deleteQueries, "query", "q", nil, "delete-by-query (can be repeated, sent in order)")
+	deleteCmd.PersistentFlags().StringVar(&deleteRoute, "route", "", "_route_ of the delete-by-queries")
+	deleteCmd.PersistentFlags().Int64Var(&deleteVersion, "version", 0, "_version_ of the delete-by-queries (0: unconditional)")
+
+	// the same as update
+	deleteCmd.PersistentFlags().IntVar(&maxDocs, "max-docs", 0, "max ids and queries per update request (0: unlimited)")
+	deleteCmd.PersistentFlags().IntVar(&maxBytes, "max-bytes", 0, "max bytes per update request (0: unlimited)")
+	deleteCmd.PersistentFlags().StringVar(&requestFormat, "request-format", "json", "format of update requests: json, xml, or javabin")
+	deleteCmd.PersistentFlags().StringVar(&commitMode, "commit", "hard", "commit mode: none, hard, soft, or end (a hard commit after all requests)")
+	deleteCmd.PersistentFlags().DurationVar(&commitWithin, "commit-within", 0, "commitWithin of update requests (0: disabled)")
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+// documentWriter writes documents in the layout that update reads.
+type documentWriter interface {
+	Write(doc solr.Document) error
+	Flush() error
+}
+
+type csvDocumentWriter struct {
+	writer    *csv.Writer
+	fields    []string // fields except id
+	separator string
+	header    bool
+}
+
+func newCSVDocumentWriter(w io.Writer, fields []string, separator string) *csvDocumentWriter {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if strings.ToUpper(field) != "ID" {
+			columns = append(columns, field)
+		}
+	}
+	return &csvDocumentWriter{
+		writer:    csv.NewWriter(w),
+		fields:    columns,
+		separator: separator,
+	}
+}
+
+// writeHeader writes the header once, before the first document.
+func (c *csvDocumentWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.writer.Write(append([]string{"id"}, c.fields...))
+}
+
+func (c *csvDocumentWriter) Write(doc solr.Document) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	record := make([]string, 0, len(c.fields)+1)
+	record = append(record, doc.ID)
+	for _, key := range c.fields {
+		idx := slices.IndexFunc(doc.Fields, func(f solr.Field) bool { return f.Key == key })
+		if idx == -1 {
+			record = append(record, "")
+			continue
+		}
+		value, err := c.formatValue(doc.Fields[idx].Value)
+		if err != nil {
+			return fmt.Errorf("document %q field %q: %w", doc.ID, key, err)
+		}
+		record = append(record, value)
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvDocumentWriter) formatValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, x := range v {
+			value, err := c.formatValue(x)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, c.separator), nil
+	default:
+		return "", fmt.Errorf("unsupported field type: %T", v)
+	}
+}
+
+// Flush writes the header even if no documents are written, so that the output is a csv that update reads.
+func (c *csvDocumentWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonlDocumentWriter struct {
+	writer *bufio.Writer
+}
+
+func newJSONLDocumentWriter(w io.Writer) *jsonlDocumentWriter {
+	return &jsonlDocumentWriter{writer: bufio.NewWriter(w)}
+}
+
+func (j *jsonlDocumentWriter) Write(doc solr.Document) error {
+	encoded, err := solr.JSONEncode(&doc, nil)
+	if err != nil {
+		return fmt.Errorf("document %q: %w", doc.ID, err)
+	}
+	if _, err := j.writer.WriteString(encoded); err != nil {
+		return err
+	}
+	return j.writer.WriteByte('\n')
+}
+
+func (j *jsonlDocumentWriter) Flush() error {
+	return j.writer.Flush()
+}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export documents sorted by id with cursorMark",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sc := solr.NewClient(solrHost, collection)
+
+		var out io.Writer = os.Stdout
+		if exportOutput != "-" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		var writer documentWriter
+		switch exportFormat {
+		case "csv":
+			if len(exportFields) == 0 {
+				return errors.New("csv export requires --fields")
+			}
+			writer = newCSVDocumentWriter(out, exportFields, exportSeparator)
+		case "jsonl":
+			writer = newJSONLDocumentWriter(out)
+		default:
+			return fmt.Errorf("unknown format: %q", exportFormat)
+		}
+
+		var fields []string
+		if len(exportFields) > 0 {
+			fields = append([]string{"id"}, exportFields...)
+		}
+		params := solr.SelectParams{
+			Query:         exportQuery,
+			FilterQueries: exportFilterQueries,
+			Fields:        fields,
+			Sort:          "id asc",
+			Rows:          exportRows,
+		}
+
+		n := 0
+		for doc, err := range sc.SelectAll(params) {
+			if err != nil {
+				return err
+			}
+			if err := writer.Write(doc); err != nil {
+				return err
+			}
+			n++
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d documents exported\n", n)
+		return nil
+	},
+}
+
+var (
+	exportOutput        string
+	exportFormat        string
+	exportFields        = []string{}
+	exportQuery         string
+	exportFilterQueries = []string{}
+	exportRows          int
+	exportSeparator     string
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.PersistentFlags().StringVarP(&exportOutput, "output", "o", "-", "output file")
+	exportCmd.PersistentFlags().StringVar(&exportFormat, "format", "csv", "output format: csv or jsonl")
+	exportCmd.PersistentFlags().StringSliceVar(&exportFields, "fields", nil, "exported fields (fl)")
+	exportCmd.PersistentFlags().StringVarP(&exportQuery, "query", "q", "*:*", "query")
+	exportCmd.PersistentFlags().StringArrayVar(&exportFilterQueries, "fq", nil, "filter query")
+	exportCmd.PersistentFlags().IntVar(&exportRows, "rows", 1000, "documents per request")
+	exportCmd.PersistentFlags().StringVar(&exportSeparator, "multi-value-separator", "|", "separator of multi-values in a csv cell")
+}
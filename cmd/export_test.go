@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+var exportedDocs = []solr.Document{
+	{ID: "1", Fields: []solr.Field{
+		{Key: "title", Value: "foo, bar"},
+		{Key: "count_i", Value: int64(10)},
+		{Key: "price_f", Value: 1.5},
+		{Key: "flag_b", Value: true},
+		{Key: "tags_ss", Value: []interface{}{"a", "b"}},
+	}},
+	{ID: "2", Fields: []solr.Field{
+		{Key: "count_i", Value: int64(20)},
+		{Key: "tags_ss", Value: []interface{}{}},
+	}},
+}
+
+func TestCSVDocumentWriter(t *testing.T) {
+	cases := []struct {
+		name      string
+		docs      []solr.Document
+		fields    []string
+		separator string
+		expected  string
+	}{
+		{
+			name:      "fields",
+			docs:      exportedDocs,
+			fields:    []string{"id", "title", "count_i", "price_f", "flag_b", "tags_ss"},
+			separator: "|",
+			expected: "id,title,count_i,price_f,flag_b,tags_ss\n" +
+				"1,\"foo, bar\",10,1.5,true,a|b\n" +
+				"2,,20,,,\n",
+		},
+		{
+			name:      "separator",
+			docs:      exportedDocs,
+			fields:    []string{"tags_ss"},
+			separator: ";",
+			expected:  "id,tags_ss\n1,a;b\n2,\n",
+		},
+		{
+			name:      "no documents",
+			fields:    []string{"id", "title", "count_i"},
+			separator: "|",
+			expected:  "id,title,count_i\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer := newCSVDocumentWriter(&buf, c.fields, c.separator)
+			for _, doc := range c.docs {
+				if err := writer.Write(doc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != c.expected {
+				t.Fatalf("\nexpected: %q\n but got: %q", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestCSVDocumentWriter_UnsupportedType(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newCSVDocumentWriter(&buf, []string{"obj"}, "|")
+	doc := solr.Document{ID: "1", Fields: []solr.Field{{Key: "obj", Value: map[string]interface{}{}}}}
+	if err := writer.Write(doc); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestJSONLDocumentWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newJSONLDocumentWriter(&buf)
+	for _, doc := range exportedDocs {
+		if err := writer.Write(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"id":"1","title":"foo, bar","count_i":10,"price_f":1.5,"flag_b":true,"tags_ss":["a","b"]}` + "\n" +
+		`{"id":"2","count_i":20,"tags_ss":[]}` + "\n"
+	if got := buf.String(); got != expected {
+		t.Fatalf("\nexpected: %s\n but got: %s", expected, got)
+	}
+}
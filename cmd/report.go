@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+// writeDiffReport writes the report in --report-format.
+func writeDiffReport(w io.Writer, report *solr.DiffReport) error {
+	switch reportFormat {
+	case "text":
+		return writeDiffText(w, report)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	default:
+		return fmt.Errorf("unknown report format: %q", reportFormat)
+	}
+}
+
+// writeDiffText writes the report for humans, a document per line followed by its changed fields.
+//
+//	atomic 1
+//	  title: "foo" -> "bar"
+func writeDiffText(w io.Writer, report *solr.DiffReport) error {
+	for _, doc := range report.Documents {
+		if _, err := fmt.Fprintf(w, "%s %s\n", doc.Status, doc.ID); err != nil {
+			return err
+		}
+		for _, field := range doc.Fields {
+			if _, err := fmt.Fprintf(w, "  %s: %s -> %s\n", field.Field, formatReportValue(field.Old), formatReportValue(field.New)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, query := range report.Queries {
+		if _, err := fmt.Fprintf(w, "delete-by-query %s\n", query.Query); err != nil {
+			return err
+		}
+	}
+
+	counts := make([]string, 0, len(solr.DiffStatuses)+1)
+	for _, status := range solr.DiffStatuses {
+		counts = append(counts, fmt.Sprintf("%s=%d", status, report.Summary[status]))
+	}
+	counts = append(counts, fmt.Sprintf("delete-by-query=%d", len(report.Queries)))
+	_, err := fmt.Fprintf(w, "summary: %s\n", strings.Join(counts, " "))
+	return err
+}
+
+// formatReportValue formats a field value as the JSON of Solr, and a missing value as (none).
+func formatReportValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	s, err := solr.JSONEncodeValue(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return s
+}
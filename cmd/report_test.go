@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestWriteDiffText(t *testing.T) {
+	report := &solr.DiffReport{
+		Documents: []solr.DocumentDiff{
+			{ID: "1", Status: solr.DiffAdd, Fields: []solr.FieldDiff{
+				{Field: "title", Old: "a", New: "b"},
+				{Field: "comments", New: solr.Document{ID: "1-c1", Fields: []solr.Field{{Key: "likes", Value: int64(1)}}}},
+				{Field: solr.ChildDocumentsField, Old: []solr.Document{{ID: "1-1"}}, New: []solr.Document{}},
+			}},
+		},
+		Summary: map[solr.DiffStatus]int{solr.DiffAdd: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiffText(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	expected := "add 1\n" +
+		`  title: "a" -> "b"` + "\n" +
+		`  comments: (none) -> {"id":"1-c1","likes":1}` + "\n" +
+		`  _childDocuments_: [{"id":"1-1"}] -> []` + "\n" +
+		"summary: unchanged=0 in-place=0 atomic=0 add=1 delete=0 delete-by-query=0\n"
+	if got := buf.String(); got != expected {
+		t.Fatalf("\nexpected: %s\n but got: %s", expected, got)
+	}
+}
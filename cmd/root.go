@@ -17,5 +17,12 @@ func Execute() {
 	}
 }
 
+var (
+	solrHost   string
+	collection string
+)
+
 func init() {
+	rootCmd.PersistentFlags().StringVar(&solrHost, "host", "localhost:8983", "solr host")
+	rootCmd.PersistentFlags().StringVar(&collection, "collection", "test", "solr collection")
 }
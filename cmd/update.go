@@ -1,78 +1,522 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/imishinist/solr-inplace-poc/internal/solr"
 )
 
-func parseCSV(in io.Reader) ([]solr.Document, error) {
-	reader := csv.NewReader(in)
-	header, err := reader.Read()
+// parseJSONL parses JSON Lines, one document per line.
+// Values keep their JSON types, and arrays are multi-values.
+func parseJSONL(in io.Reader) ([]solr.Document, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	docs := make([]solr.Document, 0)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		doc, err := solr.DecodeJSONDocument(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		docs = append(docs, doc)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// inputFormat returns the format of the input file.
+// With --input-format=auto, files named *.jsonl or *.ndjson are JSON Lines, and the others (including stdin) are csv.
+func inputFormat(fileName string) (string, error) {
+	switch inputFormatName {
+	case "csv", "jsonl":
+		return inputFormatName, nil
+	case "auto":
+		switch strings.ToLower(filepath.Ext(fileName)) {
+		case ".jsonl", ".ndjson":
+			return "jsonl", nil
+		default:
+			return "csv", nil
+		}
+	default:
+		return "", fmt.Errorf("unknown input format: %q", inputFormatName)
+	}
+}
+
+// parseInput parses the documents of the file in the format of --input-format.
+// All documents are held in memory; only the update requests are streamed.
+func parseInput(fileName string, opts csvOptions) ([]solr.Document, error) {
+	format, err := inputFormat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	in, err := openFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if format == "jsonl" {
+		return parseJSONL(in)
+	}
+	return parseCSV(in, opts)
+}
+
+// openFile reads the whole file into memory, or returns stdin for "-".
+func openFile(fileName string) (io.Reader, error) {
+	if fileName == "-" {
+		return os.Stdin, nil
+	}
+	f, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+
+	buf := new(bytes.Buffer)
+	io.Copy(buf, f)
+	return buf, nil
+}
+
+// loadSchema loads the schema from --schema file or Solr.
+// It returns nil if the schema is not specified.
+func loadSchema(sc *solr.Client) (*solr.Schema, error) {
+	if schemaFromSolr {
+		return sc.Schema()
+	}
+	if schemaFile == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return solr.LoadSchemaXML(f)
+}
+
+// loadPolicy loads the field policy from --policy file,
+// or makes it from --allowed-fields and --inplace-fields.
+func loadPolicy(cmd *cobra.Command) (solr.Policy, error) {
+	if policyFile == "" {
+		return solr.PolicyFromFields(allowedFields, inplaceFields), nil
+	}
+	if cmd.Flags().Changed("allowed-fields") || cmd.Flags().Changed("inplace-fields") {
+		return solr.Policy{}, errors.New("--policy and --allowed-fields/--inplace-fields are exclusive")
+	}
+
+	f, err := os.Open(policyFile)
+	if err != nil {
+		return solr.Policy{}, err
+	}
+	defer f.Close()
+	policy, err := solr.LoadPolicy(f)
+	if err != nil {
+		return solr.Policy{}, fmt.Errorf("%s: %w", policyFile, err)
+	}
+	return policy, nil
+}
+
+// schemaInPlaceFields sets the in-place update fields determined by the schema to the policy.
+// Only the fields to be re-indexed are changed to in-place.
+// If the policy has in-place fields, it validates them instead.
+func schemaInPlaceFields(schema *solr.Schema, policy solr.Policy, docs []solr.Document) error {
+	inplace := policy.FieldsOf(func(p solr.FieldPolicy) bool { return p == solr.PolicyInPlace })
+	if len(inplace) > 0 {
+		for _, field := range inplace {
+			if !schema.InPlaceUpdatable(field) {
+				return fmt.Errorf("field %q can not be updated in-place", field)
+			}
+		}
+		return nil
+	}
 
-	// extract "ID"
-	idIndex := -1
-	for i, field := range header {
-		if strings.ToUpper(field) == "ID" {
-			idIndex = i
+	candidates := policy.AllowedFields()
+	if candidates == nil {
+		for _, doc := range docs {
+			for _, field := range doc.Fields {
+				if !slices.Contains(candidates, field.Key) {
+					candidates = append(candidates, field.Key)
+				}
+			}
 		}
 	}
-	if idIndex == -1 {
-		return nil, errors.New("csv should contains id field")
+	for _, field := range schema.InPlaceUpdateFields(candidates) {
+		if policy.Of(field) == solr.PolicyReindex {
+			policy.Fields[field] = solr.PolicyInPlace
+		}
 	}
+	return nil
+}
 
-	docs := make([]solr.Document, 0)
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+func printUpdateResponse(resp *solr.UpdateResponse) {
+	fmt.Printf("status=%d QTime=%d\n", resp.ResponseHeader.Status, resp.ResponseHeader.QTime)
+	for _, e := range resp.ResponseHeader.Errors {
+		fmt.Printf("  %s %s: %s\n", e.Type, e.ID, e.Message)
+	}
+}
+
+func printSolrError(err error) {
+	var solrErr *solr.SolrError
+	if !errors.As(err, &solrErr) {
+		return
+	}
+	fmt.Printf("status=%d code=%d\n", solrErr.ResponseHeader.Status, solrErr.Code)
+	fmt.Printf("  %s\n", solrErr.Msg)
+	if solrErr.VersionConflict() {
+		fmt.Println("  the update is rejected by a version conflict")
+	}
+}
+
+// updateOptions returns the options of each update request.
+// With --commit=end, requests are not committed and commitAtEnd commits them.
+func updateOptions(cmd *cobra.Command) (solr.UpdateOptions, error) {
+	encoder, err := newEncoder()
+	if err != nil {
+		return solr.UpdateOptions{}, err
+	}
+	opts := solr.UpdateOptions{
+		CommitWithin: commitWithin,
+		ContentType:  encoder.ContentType(),
+	}
+	if cmd.Flags().Changed("open-searcher") {
+		opts.OpenSearcher = &openSearcher
+	}
+	if optimistic {
+		opts.FailOnVersionConflicts = true
+		opts.UpdateChain = "tolerant"
+	}
+	if cmd.Flags().Changed("update-chain") {
+		opts.UpdateChain = updateChain
+	}
+	if commitMode == "end" {
+		return opts, nil
+	}
+
+	mode, err := solr.ParseCommitMode(commitMode)
+	if err != nil {
+		return opts, err
+	}
+	opts.Commit = mode
+	return opts, nil
+}
+
+// commitAtEnd commits once if --commit=end.
+func commitAtEnd(sc *solr.Client, opts solr.UpdateOptions) error {
+	if commitMode != "end" {
+		return nil
+	}
+
+	resp, err := sc.Commit(solr.UpdateOptions{Commit: solr.CommitHard, OpenSearcher: opts.OpenSearcher})
+	if err != nil {
+		printSolrError(err)
+		return err
+	}
+	fmt.Println("commit:")
+	printUpdateResponse(resp)
+	return nil
+}
+
+// newEncoder returns the encoder of --request-format.
+func newEncoder() (solr.Encoder, error) {
+	switch requestFormat {
+	case "json":
+		return solr.JSONEncoder{}, nil
+	case "xml":
+		return solr.XMLEncoder{}, nil
+	case "javabin":
+		return solr.JavabinEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown request format: %q", requestFormat)
+	}
+}
+
+// binaryRequest reports whether update requests are not printable.
+func binaryRequest() bool {
+	return requestFormat == "javabin"
+}
+
+// newBuilder returns the builder configured by the flags.
+func newBuilder() (*solr.UpdateBatchBuilder, error) {
+	encoder, err := newEncoder()
+	if err != nil {
+		return nil, err
+	}
+	builder := solr.NewUpdateBatchBuilderWithPolicy(fieldPolicy)
+	builder.SetEncoder(encoder)
+	builder.SetRemoveWithNull(removeWithNull)
+	builder.SetOptimisticConcurrency(optimistic)
+	mode, err := solr.ParseSyncMode(syncMode)
+	if err != nil {
+		return nil, err
+	}
+	builder.SetSyncMode(mode)
+	builder.SetMaxDeletePercent(maxDeletePercent)
+	for field, name := range operations {
+		op, err := solr.ParseOperation(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := builder.SetOperation(field, op); err != nil {
+			return nil, err
+		}
+	}
+	return builder, nil
+}
+
+// childTransformer fetches all child documents with all their fields.
+// By default, [child] returns at most 10 children with the fields of the parent fl.
+const childTransformer = "[child limit=-1 fl=*]"
+
+// fetchFields returns the fields fetched from Solr as old documents: the columns of the input
+// limited to the allowed fields, so that the stored fields missing from the input are not compared.
+// nested adds the child documents to compare them with the nested new documents.
+func fetchFields(nested bool, columns []string) []string {
+	fields := []string{"id", solr.VersionField}
+	if nested {
+		fields = append(fields, childTransformer)
+	}
+	allowedFields := fieldPolicy.AllowedFields()
+	for _, column := range columns {
+		if allowedFields == nil || slices.Contains(allowedFields, column) {
+			fields = append(fields, column)
+		}
+	}
+	return fields
+}
+
+// inputColumns returns the sorted fields of docs, except for id and _version_.
+func inputColumns(docs iter.Seq[solr.Document]) []string {
+	columns := make(map[string]struct{})
+	for doc := range docs {
+		for _, field := range doc.Fields {
+			if field.Key != solr.VersionField {
+				columns[field.Key] = struct{}{}
+			}
 		}
+	}
+	return slices.Sorted(maps.Keys(columns))
+}
+
+// conform converts the old documents fetched from Solr to the representation of the new documents with the same ids,
+// e.g. the numbers of Solr to the strings of CSV cells.
+func conform(olds []solr.Document, docs iter.Seq[solr.Document]) []solr.Document {
+	docSet := make(solr.DocSet)
+	for doc := range docs {
+		docSet.Add(doc)
+	}
+	for i, old := range olds {
+		if doc, ok := docSet[old.ID]; ok {
+			olds[i] = solr.ConformDocument(old, doc)
+		}
+	}
+	return olds
+}
+
+// fetchNested reports whether the old documents are fetched with their child documents:
+// with --nested, or if any of docs has child documents.
+// Without --nested, removing all children of the documents is not detected.
+func fetchNested(docs iter.Seq[solr.Document]) bool {
+	return nested || hasChildren(docs)
+}
+
+// hasChildren reports whether any of docs has child documents.
+func hasChildren(docs iter.Seq[solr.Document]) bool {
+	for doc := range docs {
+		if doc.HasChildren() {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchOld fetches the current state of docs from Solr in chunks.
+func fetchOld(sc *solr.Client, docs []solr.Document) ([]solr.Document, error) {
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+
+	fields := fetchFields(fetchNested(slices.Values(docs)), inputColumns(slices.Values(docs)))
+	olds := make([]solr.Document, 0, len(docs))
+	for chunk := range slices.Chunk(ids, fetchSize) {
+		fetched, err := sc.Get(chunk, fields)
 		if err != nil {
 			return nil, err
 		}
+		olds = append(olds, fetched...)
+	}
+	fmt.Fprintf(progress, "fetched %d/%d documents from solr\n", len(olds), len(ids))
+	return conform(olds, slices.Values(docs)), nil
+}
+
+// rootFilter excludes child documents, which *:* matches as well as their parents.
+const rootFilter = "-_nest_path_:*"
+
+const (
+	nestPathField = "_nest_path_"
+	// rootField is the id of the root document of a block, set to the children as well as the root.
+	rootField = "_root_"
+)
+
+// fetchAll fetches all documents from Solr as the old snapshot of a full sync.
+// Child documents are not fetched as top-level documents, so that they are not deleted as the documents missing from docs:
+// they are excluded by _nest_path_, or found by a stored _root_ to fail the sync.
+// It fails if the schema can tell neither.
+func fetchAll(sc *solr.Client, schema *solr.Schema, docs []solr.Document) ([]solr.Document, error) {
+	withChildren := fetchNested(slices.Values(docs))
+	params := solr.SelectParams{
+		Query:  "*:*",
+		Fields: fetchFields(withChildren, inputColumns(slices.Values(docs))),
+		Sort:   "id asc",
+		Rows:   fetchSize,
+	}
+	_, hasNestPath := schema.Field(nestPathField)
+	root, hasRoot := schema.Field(rootField)
+	checkRoot := false
+	switch {
+	case hasNestPath:
+		params.FilterQueries = []string{rootFilter}
+	case withChildren:
+		return nil, fmt.Errorf("full sync of nested documents requires %s in the schema", nestPathField)
+	case hasRoot && (root.Stored || root.DocValues):
+		params.Fields = append(params.Fields, rootField)
+		checkRoot = true
+	case hasRoot:
+		return nil, fmt.Errorf("full sync can not tell child documents from their parents: the schema has neither %s nor a stored %s", nestPathField, rootField)
+	}
 
-		doc := solr.Document{
-			Fields: make([]solr.Field, 0, len(record)),
+	olds := make([]solr.Document, 0)
+	for doc, err := range sc.SelectAll(params) {
+		if err != nil {
+			return nil, err
 		}
-		for i, field := range record {
-			if i == idIndex {
-				doc.ID = field
-				continue
+		if checkRoot {
+			if err := checkRootDocument(&doc); err != nil {
+				return nil, err
 			}
-			doc.Fields = append(doc.Fields, solr.Field{
-				Key:   header[i],
-				Value: field,
-			})
 		}
-		docs = append(docs, doc)
+		olds = append(olds, doc)
 	}
-	return docs, nil
+	fmt.Fprintf(progress, "fetched %d documents from solr\n", len(olds))
+	return conform(olds, slices.Values(docs)), nil
 }
 
-func openFile(fileName string) (io.Reader, error) {
-	if fileName == "-" {
-		return os.Stdin, nil
+// checkRootDocument fails if doc is a child document, whose _root_ is not its id.
+// _root_ is removed from doc not to be compared with the new document.
+func checkRootDocument(doc *solr.Document) error {
+	for i, field := range doc.Fields {
+		if field.Key != rootField {
+			continue
+		}
+		if root, ok := field.Value.(string); ok && root != doc.ID {
+			return fmt.Errorf("document %q is a child document of %q: full sync of nested documents requires %s in the schema", doc.ID, root, nestPathField)
+		}
+		doc.Fields = slices.Delete(doc.Fields, i, i+1)
+		return nil
 	}
-	f, err := os.Open(fileName)
+	return nil
+}
+
+// send sends the updates of builder, and returns the documents rejected by version conflicts.
+func send(sc *solr.Client, builder *solr.UpdateBatchBuilder, opts solr.UpdateOptions) ([]solr.DocumentError, error) {
+	limit := solr.BatchLimit{MaxDocs: maxDocs, MaxBytes: maxBytes}
+	if limit != (solr.BatchLimit{}) {
+		return sendBatches(sc, builder, limit, opts)
+	}
+
+	// stream the body to solr while printing it
+	var echo io.Writer = os.Stdout
+	if binaryRequest() {
+		echo = io.Discard
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(builder.BuildTo(io.MultiWriter(pw, echo)))
+	}()
+
+	resp, err := sc.UpdateFrom(pr, opts)
+	fmt.Println()
+	fmt.Println()
 	if err != nil {
+		printSolrError(err)
 		return nil, err
 	}
-	defer f.Close()
+	printUpdateResponse(resp)
+	return resp.VersionConflicts(), nil
+}
 
-	buf := new(bytes.Buffer)
-	io.Copy(buf, f)
-	return buf, nil
+// retry re-fetches the current state of the conflicted documents from Solr, and sends their updates again.
+func retry(sc *solr.Client, builder *solr.UpdateBatchBuilder, conflicts []solr.DocumentError, opts solr.UpdateOptions) ([]solr.DocumentError, error) {
+	ids := make([]string, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		ids = append(ids, conflict.ID)
+	}
+
+	olds, err := sc.Get(ids, fetchFields(fetchNested(maps.Values(builder.Documents)), inputColumns(maps.Values(builder.Documents))))
+	if err != nil {
+		return nil, err
+	}
+	olds = conform(olds, maps.Values(builder.Documents))
+
+	retryBuilder, err := newBuilder()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if doc, ok := builder.Documents[id]; ok {
+			retryBuilder.Add(doc)
+		}
+	}
+	retryBuilder.AddOld(olds...)
+	return send(sc, retryBuilder, opts)
+}
+
+// sendBatches sends the update request split into batches sequentially.
+func sendBatches(sc *solr.Client, builder *solr.UpdateBatchBuilder, limit solr.BatchLimit, opts solr.UpdateOptions) ([]solr.DocumentError, error) {
+	conflicts := make([]solr.DocumentError, 0)
+	n := 0
+	for body, err := range builder.Batches(limit) {
+		if err != nil {
+			return nil, err
+		}
+		n++
+
+		fmt.Printf("batch %d: %d bytes\n", n, len(body))
+		if !binaryRequest() {
+			fmt.Println(body)
+			fmt.Println()
+		}
+
+		resp, err := sc.Update(body, opts)
+		if err != nil {
+			printSolrError(err)
+			return nil, fmt.Errorf("batch %d: %w", n, err)
+		}
+		printUpdateResponse(resp)
+		fmt.Println()
+		conflicts = append(conflicts, resp.VersionConflicts()...)
+	}
+	fmt.Printf("%d batches sent\n", n)
+	return conflicts, nil
 }
 
 // updateCmd represents the update command
@@ -80,79 +524,199 @@ var updateCmd = &cobra.Command{
 	Use: "update",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		sc := solr.NewClient(solrHost, collection)
+		if dryRun {
+			// keep stdout for the report
+			progress = os.Stderr
+		}
 
 		if csvFile == "" {
-			return errors.New("csv file is empty")
+			return errors.New("input file is empty")
+		}
+		if len(multiValuedFields) > 0 && multiValueSeparator == "" {
+			return errors.New("multi-value separator is empty")
 		}
 
-		in, err := openFile(csvFile)
+		columnTypes, err := loadColumnTypes(columnTypesFile)
+		if err != nil {
+			return err
+		}
+		opts := csvOptions{
+			columnTypes:       columnTypes,
+			multiValuedFields: multiValuedFields,
+			separator:         multiValueSeparator,
+		}
+		docs, err := parseInput(csvFile, opts)
 		if err != nil {
 			return err
 		}
 
-		docs, err := parseCSV(in)
+		schema, err := loadSchema(sc)
 		if err != nil {
 			return err
 		}
+		if fieldPolicy, err = loadPolicy(cmd); err != nil {
+			return err
+		}
+		if schema != nil {
+			if err := schemaInPlaceFields(schema, fieldPolicy, docs); err != nil {
+				return err
+			}
+		}
 
-		fmt.Printf("allowed fields: %+v\n", allowedFields)
-		fmt.Printf("inplace fields: %+v\n", inplaceFields)
+		fmt.Fprintf(progress, "default policy: %s\n", fieldPolicy.Default)
+		fmt.Fprintf(progress, "field policies: %+v\n", fieldPolicy.Fields)
 
-		builder := solr.NewUpdateBatchBuilder(allowedFields, inplaceFields)
+		builder, err := newBuilder()
+		if err != nil {
+			return err
+		}
 		builder.Add(docs...)
 
-		if oldCsvFile != "" {
-
-			old, err := openFile(oldCsvFile)
+		if oldCsvFile != "" && oldFromSolr {
+			return errors.New("--old-csv and --old-from-solr are exclusive")
+		}
+		if oldFromSolr {
+			if fetchSize <= 0 {
+				return errors.New("fetch size should be positive")
+			}
+			var olds []solr.Document
+			if syncMode == "full" {
+				// a full sync needs all documents to find the deleted ones,
+				// and the schema to tell child documents from them
+				if schema == nil {
+					if schema, err = sc.Schema(); err != nil {
+						return err
+					}
+				}
+				olds, err = fetchAll(sc, schema, docs)
+			} else {
+				olds, err = fetchOld(sc, docs)
+			}
 			if err != nil {
 				return err
 			}
-			olds, err := parseCSV(old)
+			builder.AddOld(olds...)
+		}
+		if oldCsvFile != "" {
+			olds, err := parseInput(oldCsvFile, opts)
 			if err != nil {
 				return err
 			}
 			builder.AddOld(olds...)
 		}
 
-		var (
-			body string
-		)
-		if body, err = builder.Build(); err != nil {
+		if dryRun {
+			report, err := builder.Diff()
+			if err != nil {
+				return err
+			}
+			return writeDiffReport(os.Stdout, report)
+		}
+
+		updateOpts, err := updateOptions(cmd)
+		if err != nil {
 			return err
 		}
-		fmt.Println(body)
-		fmt.Println()
 
-		resp, err := sc.Update(body)
+		conflicts, err := send(sc, builder, updateOpts)
 		if err != nil {
 			return err
 		}
-		defer resp.Close()
-		io.Copy(os.Stdout, resp)
+		for i := 0; i < retryConflicts && len(conflicts) > 0; i++ {
+			fmt.Printf("retry %d: %d version conflicts\n", i+1, len(conflicts))
+			if conflicts, err = retry(sc, builder, conflicts, updateOpts); err != nil {
+				return err
+			}
+		}
+		if len(conflicts) > 0 {
+			fmt.Printf("%d documents are rejected by version conflicts\n", len(conflicts))
+			for _, conflict := range conflicts {
+				fmt.Printf("  %s: %s\n", conflict.ID, conflict.Message)
+			}
+		}
 
-		return nil
+		return commitAtEnd(sc, updateOpts)
 	},
 }
 
 var (
-	solrHost   string
-	collection string
+	csvFile     string
+	oldCsvFile  string
+	oldFromSolr bool
+	fetchSize   int
 
-	csvFile    string
-	oldCsvFile string
+	inputFormatName string
 
 	allowedFields = []string{}
 	inplaceFields = []string{}
+	operations    = map[string]string{}
+	policyFile    string
+	fieldPolicy   solr.Policy
+
+	removeWithNull bool
+
+	syncMode         string
+	maxDeletePercent float64
+
+	optimistic     bool
+	updateChain    string
+	retryConflicts int
+
+	maxDocs  int
+	maxBytes int
+
+	requestFormat string
+
+	commitMode   string
+	commitWithin time.Duration
+	openSearcher bool
+
+	schemaFile     string
+	schemaFromSolr bool
+
+	multiValuedFields   = []string{}
+	multiValueSeparator string
+	columnTypesFile     string
+
+	nested bool
+
+	dryRun       bool
+	reportFormat string
+
+	// progress is where the progress of the update is printed.
+	progress io.Writer = os.Stdout
 )
 
 func init() {
 	rootCmd.AddCommand(updateCmd)
 
-	updateCmd.PersistentFlags().StringVar(&solrHost, "host", "localhost:8983", "solr host")
-	updateCmd.PersistentFlags().StringVar(&collection, "collection", "test", "solr collection")
-
-	updateCmd.PersistentFlags().StringVar(&csvFile, "csv", "-", "csv file")
-	updateCmd.PersistentFlags().StringVar(&oldCsvFile, "old-csv", "", "old csv file")
+	updateCmd.PersistentFlags().StringVar(&csvFile, "csv", "-", "input file (csv or jsonl)")
+	updateCmd.PersistentFlags().StringVar(&oldCsvFile, "old-csv", "", "old input file (csv or jsonl)")
+	updateCmd.PersistentFlags().StringVar(&inputFormatName, "input-format", "auto", "input format: auto (by file extension), csv, or jsonl")
+	updateCmd.PersistentFlags().BoolVar(&oldFromSolr, "old-from-solr", false, "fetch old documents from solr with real-time get")
+	updateCmd.PersistentFlags().IntVar(&fetchSize, "fetch-size", 100, "number of ids fetched from solr per request")
 	updateCmd.PersistentFlags().StringSliceVarP(&allowedFields, "allowed-fields", "a", nil, "allowed fields")
 	updateCmd.PersistentFlags().StringSliceVarP(&inplaceFields, "inplace-fields", "i", nil, "inplace fields")
+	updateCmd.PersistentFlags().StringVar(&policyFile, "policy", "", "field policy file (yaml or json) of ignore, reindex, always-send, atomic-set, in-place, increment, append-distinct, remove-if-empty, and passive, and normalizers (trim, nfc, case-fold, numeric, date) applied before comparison, instead of --allowed-fields and --inplace-fields")
+	updateCmd.PersistentFlags().StringToStringVar(&operations, "operations", nil, "atomic update operations per field: set, inc, add, add-distinct, or remove (e.g. count_i=inc,tags_s=add)")
+	updateCmd.PersistentFlags().BoolVar(&removeWithNull, "remove-with-null", false, `remove fields by atomic update {"set":null} instead of re-indexing`)
+	updateCmd.PersistentFlags().StringVar(&syncMode, "sync", "partial", "partial (old documents not in the input are kept) or full (they are deleted)")
+	updateCmd.PersistentFlags().Float64Var(&maxDeletePercent, "max-delete-percent", 10, "fail a full sync that deletes more than the percent of old documents (0: no limit)")
+	updateCmd.PersistentFlags().BoolVar(&optimistic, "optimistic", false, "send updates conditional on _version_ of old documents")
+	updateCmd.PersistentFlags().StringVar(&updateChain, "update-chain", "", `update request processor chain (default "tolerant" with --optimistic)`)
+	updateCmd.PersistentFlags().IntVar(&retryConflicts, "retry-conflicts", 0, "number of retries of version conflicted documents with their current state fetched from solr")
+	updateCmd.PersistentFlags().IntVar(&maxDocs, "max-docs", 0, "max documents per update request (0: unlimited)")
+	updateCmd.PersistentFlags().IntVar(&maxBytes, "max-bytes", 0, "max bytes per update request (0: unlimited)")
+	updateCmd.PersistentFlags().StringVar(&requestFormat, "request-format", "json", "format of update requests: json, xml (for handlers that accept only xml), or javabin")
+	updateCmd.PersistentFlags().StringVar(&commitMode, "commit", "hard", "commit mode: none, hard, soft, or end (a hard commit after all requests)")
+	updateCmd.PersistentFlags().DurationVar(&commitWithin, "commit-within", 0, "commitWithin of update requests (0: disabled)")
+	updateCmd.PersistentFlags().BoolVar(&openSearcher, "open-searcher", true, "openSearcher of hard commits")
+	updateCmd.PersistentFlags().StringVar(&schemaFile, "schema", "", "schema.xml to determine in-place update fields")
+	updateCmd.PersistentFlags().BoolVar(&schemaFromSolr, "schema-from-solr", false, "fetch the schema from solr to determine in-place update fields")
+	updateCmd.PersistentFlags().StringSliceVarP(&multiValuedFields, "multi-valued-fields", "m", nil, "multi-valued fields")
+	updateCmd.PersistentFlags().StringVar(&multiValueSeparator, "multi-value-separator", "|", "separator of multi-values in a csv cell")
+	updateCmd.PersistentFlags().BoolVar(&nested, "nested", false, "the collection has nested documents: fetch old documents with all their children to detect removed children")
+	updateCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "send nothing, and print the report of the updates instead")
+	updateCmd.PersistentFlags().StringVar(&reportFormat, "report-format", "text", "format of the --dry-run report: text or json")
+	updateCmd.PersistentFlags().StringVar(&columnTypesFile, "column-types", "", `column spec file of csv column types, one "column:type" per line (types: string, int, long, float, double, bool, date, and "[]" suffixed multi-values)`)
 }
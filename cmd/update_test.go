@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *solr.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return solr.NewClient(strings.TrimPrefix(server.URL, "http://"), "test")
+}
+
+// setFlags sets the flag variables of the update command during the test.
+func setFlags(t *testing.T, policy solr.Policy, nestedDocs bool) {
+	t.Helper()
+
+	savedPolicy, savedNested, savedFetchSize, savedProgress := fieldPolicy, nested, fetchSize, progress
+	t.Cleanup(func() {
+		fieldPolicy, nested, fetchSize, progress = savedPolicy, savedNested, savedFetchSize, savedProgress
+	})
+	fieldPolicy, nested, fetchSize, progress = policy, nestedDocs, 100, io.Discard
+}
+
+func TestFetchOld_Nested(t *testing.T) {
+	cases := []struct {
+		name     string
+		nested   bool
+		docs     []solr.Document
+		response string
+		fl       string
+		expected string
+	}{
+		{
+			name: "not nested",
+			docs: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "title", Value: "foo"}}},
+			},
+			response: `{"id":"1","title":"foo"}`,
+			fl:       "id,_version_,title",
+			expected: "{}",
+		},
+		{
+			name: "input with children",
+			docs: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "title", Value: "foo"}}, Children: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "a"}}},
+				}},
+			},
+			response: `{"id":"1","title":"foo","_childDocuments_":[{"id":"1-1","comment":"a","_version_":1}]}`,
+			fl:       "id,_version_,[child limit=-1 fl=*],title",
+			expected: "{}",
+		},
+		{
+			name:   "all children removed",
+			nested: true,
+			docs: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "title", Value: "foo"}}},
+			},
+			response: `{"id":"1","title":"foo","_childDocuments_":[{"id":"1-1","comment":"a","_version_":1}]}`,
+			fl:       "id,_version_,[child limit=-1 fl=*],title",
+			expected: `{"add":{"doc":{"id":"1","title":"foo"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setFlags(t, solr.PolicyFromFields(nil, nil), c.nested)
+			sc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("fl"); got != c.fl {
+					t.Errorf("unexpected fl: %s", got)
+				}
+				// a single id is returned as "doc"
+				w.Write([]byte(`{"doc":` + c.response + `}`))
+			})
+
+			olds, err := fetchOld(sc, c.docs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			builder := solr.NewUpdateBatchBuilderWithPolicy(fieldPolicy)
+			builder.Add(c.docs...)
+			builder.AddOld(olds...)
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected: %v\n but got: %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetchOld_CSV(t *testing.T) {
+	// the values of /get are typed, while the csv cells are strings
+	response := `{"doc":{"id":"1","count_i":10,"price_f":1.5,"flag_b":true,"tags_ss":["a","b"],"title":"foo","_version_":1}}`
+
+	cases := []struct {
+		name     string
+		csv      string
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			csv:      "id,count_i,price_f,flag_b,tags_ss,title\n1,10,1.5,true,a|b,foo\n",
+			expected: "{}",
+		},
+		{
+			name:     "changed",
+			csv:      "id,count_i,price_f,flag_b,tags_ss,title\n1,11,1.5,true,a|b,foo\n",
+			expected: `{"add":{"doc":{"id":"1","count_i":"11","flag_b":"true","price_f":"1.5","tags_ss":["a","b"],"title":"foo"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setFlags(t, solr.PolicyFromFields(nil, nil), false)
+			sc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("fl"); got != "id,_version_,count_i,flag_b,price_f,tags_ss,title" {
+					t.Errorf("unexpected fl: %s", got)
+				}
+				w.Write([]byte(response))
+			})
+
+			docs, err := parseCSV(strings.NewReader(c.csv), csvOptions{multiValuedFields: []string{"tags_ss"}, separator: "|"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			olds, err := fetchOld(sc, docs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			builder := solr.NewUpdateBatchBuilderWithPolicy(fieldPolicy)
+			builder.Add(docs...)
+			builder.AddOld(olds...)
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected: %v\n but got: %v", c.expected, got)
+			}
+		})
+	}
+}
+
+// loadTestSchema loads the schema.xml that has the fields.
+func loadTestSchema(t *testing.T, fields string) *solr.Schema {
+	t.Helper()
+
+	schema, err := solr.LoadSchemaXML(strings.NewReader(`<schema name="test" version="1.6">` +
+		`<uniqueKey>id</uniqueKey>` +
+		`<fieldType name="string" class="solr.StrField"/>` +
+		`<fieldType name="_nest_path_" class="solr.NestPathField"/>` +
+		`<field name="id" type="string" required="true"/>` +
+		fields +
+		`</schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestFetchAll_Nested(t *testing.T) {
+	cases := []struct {
+		name     string
+		nested   bool
+		fields   string
+		expected []solr.Document
+		wantErr  string
+	}{
+		{
+			name:     "_nest_path_",
+			nested:   true,
+			fields:   `<field name="_root_" type="string" stored="false"/><field name="_nest_path_" type="_nest_path_"/>`,
+			expected: []solr.Document{{ID: "1", Children: []solr.Document{{ID: "1-1"}}}, {ID: "2"}},
+		},
+		{
+			name:    "nested without _nest_path_",
+			nested:  true,
+			fields:  `<field name="_root_" type="string"/>`,
+			wantErr: "full sync of nested documents requires _nest_path_ in the schema",
+		},
+		{
+			name:    "stored _root_",
+			fields:  `<field name="_root_" type="string"/>`,
+			wantErr: `document "1-1" is a child document of "1": full sync of nested documents requires _nest_path_ in the schema`,
+		},
+		{
+			name:    "unstored _root_",
+			fields:  `<field name="_root_" type="string" stored="false"/>`,
+			wantErr: "full sync can not tell child documents from their parents: the schema has neither _nest_path_ nor a stored _root_",
+		},
+		{
+			name:     "no _root_",
+			expected: []solr.Document{{ID: "1"}, {ID: "1-1"}, {ID: "2"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setFlags(t, solr.PolicyFromFields(nil, nil), c.nested)
+			sc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("cursorMark") != "*" {
+					w.Write([]byte(`{"response":{"numFound":3,"start":0,"docs":[]},"nextCursorMark":"c1"}`))
+					return
+				}
+				// *:* matches the child documents as well as their parents
+				docs := `{"id":"1","_root_":"1","_childDocuments_":[{"id":"1-1"}]},{"id":"1-1","_root_":"1"},{"id":"2","_root_":"2"}`
+				if slices.Contains(query["fq"], "-_nest_path_:*") {
+					docs = `{"id":"1","_childDocuments_":[{"id":"1-1"}]},{"id":"2"}`
+				} else if !strings.Contains(query.Get("fl"), "_root_") {
+					docs = `{"id":"1"},{"id":"1-1"},{"id":"2"}`
+				}
+				w.Write([]byte(`{"response":{"numFound":3,"start":0,"docs":[` + docs + `]},"nextCursorMark":"c1"}`))
+			})
+
+			olds, err := fetchAll(sc, loadTestSchema(t, c.fields), []solr.Document{{ID: "1"}, {ID: "2"}})
+			if c.wantErr != "" {
+				if err == nil || err.Error() != c.wantErr {
+					t.Fatalf("expected error %q, but got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, olds, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetchAll_StoredRoot(t *testing.T) {
+	setFlags(t, solr.PolicyFromFields(nil, nil), false)
+	sc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("fl"); got != "id,_version_,title,_root_" {
+			t.Errorf("unexpected fl: %s", got)
+		}
+		w.Write([]byte(`{"response":{"numFound":1,"start":0,"docs":[{"id":"1","title":"foo","_root_":"1"}]},"nextCursorMark":"*"}`))
+	})
+
+	docs := []solr.Document{{ID: "1", Fields: []solr.Field{{Key: "title", Value: "foo"}}}}
+	olds, err := fetchAll(sc, loadTestSchema(t, `<field name="_root_" type="string"/>`), docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// _root_ is not compared with the new document
+	if diff := cmp.Diff(docs, olds); diff != "" {
+		t.Errorf("(-expected, +got)\n%s", diff)
+	}
+}
@@ -0,0 +1,334 @@
+package javabin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// errEnd is returned by readValue at END, which is valid only at the end of an iterator.
+var errEnd = errors.New("unexpected end")
+
+// Decoder reads javabin values.
+//
+// Values are decoded as:
+//
+//	NULL: nil, BOOL: bool, BYTE: int8, SHORT: int16, INT/SINT: int32, LONG/SLONG: int64,
+//	FLOAT: float32, DOUBLE: float64, DATE: time.Time (UTC), STR: string, BYTEARR: []byte,
+//	ARR: []interface{}, ITERATOR: Iterator, MAP: Map, NAMED_LST/ORDERED_MAP: NamedList,
+//	SOLRINPUTDOC: *InputDocument, MAP_ENTRY: MapEntry.
+type Decoder struct {
+	r *bufio.Reader
+
+	// externStrings are the strings referred by EXTERN_STRING
+	externStrings []string
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Unmarshal decodes a javabin stream that starts with the version.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := NewDecoder(bytes.NewReader(data))
+	if err := d.ReadVersion(); err != nil {
+		return nil, err
+	}
+	v, err := d.ReadValue()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after the value")
+	}
+	return v, nil
+}
+
+// ReadVersion reads the version at the beginning of a stream.
+func (d *Decoder) ReadVersion() error {
+	version, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != Version {
+		return fmt.Errorf("unsupported version: %d", version)
+	}
+	return nil
+}
+
+// ReadValue reads a value.
+func (d *Decoder) ReadValue() (interface{}, error) {
+	return d.readValue()
+}
+
+func (d *Decoder) readValue() (interface{}, error) {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag & 0xe0 {
+	case tagStr:
+		return d.readString(tag)
+	case tagSInt:
+		i, err := d.readSmallInt(tag)
+		return int32(i), err
+	case tagSLong:
+		i, err := d.readSmallInt(tag)
+		return i, err
+	case tagArr:
+		size, err := d.readSize(tag)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, min(size, 1024))
+		for range size {
+			v, err := d.readValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case tagOrderedMap, tagNamedList:
+		size, err := d.readSize(tag)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := d.readEntries(size)
+		return NamedList(entries), err
+	case tagExternString:
+		idx, err := d.readSize(tag)
+		if err != nil {
+			return nil, err
+		}
+		if idx > 0 {
+			if idx > len(d.externStrings) {
+				return nil, fmt.Errorf("unknown extern string: %d", idx)
+			}
+			return d.externStrings[idx-1], nil
+		}
+		s, err := d.readKey()
+		if err != nil {
+			return nil, err
+		}
+		d.externStrings = append(d.externStrings, s)
+		return s, nil
+	}
+
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagBoolTrue:
+		return true, nil
+	case tagBoolFalse:
+		return false, nil
+	case tagByte:
+		b, err := d.r.ReadByte()
+		return int8(b), err
+	case tagShort:
+		var buf [2]byte
+		_, err := io.ReadFull(d.r, buf[:])
+		return int16(binary.BigEndian.Uint16(buf[:])), err
+	case tagInt:
+		var buf [4]byte
+		_, err := io.ReadFull(d.r, buf[:])
+		return int32(binary.BigEndian.Uint32(buf[:])), err
+	case tagLong:
+		i, err := d.readLong()
+		return i, err
+	case tagFloat:
+		var buf [4]byte
+		_, err := io.ReadFull(d.r, buf[:])
+		return math.Float32frombits(binary.BigEndian.Uint32(buf[:])), err
+	case tagDouble:
+		i, err := d.readLong()
+		return math.Float64frombits(uint64(i)), err
+	case tagDate:
+		i, err := d.readLong()
+		return time.UnixMilli(i).UTC(), err
+	case tagByteArr:
+		size, err := d.readVInt()
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(d.r, buf)
+		return buf, err
+	case tagMap:
+		size, err := d.readVInt()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := d.readEntries(size)
+		return Map(entries), err
+	case tagIterator:
+		values := make(Iterator, 0)
+		for {
+			v, err := d.readValue()
+			if err == errEnd {
+				return values, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	case tagEnd:
+		return nil, errEnd
+	case tagInputDoc:
+		return d.readInputDocument()
+	case tagMapEntry:
+		key, err := d.readValue()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readValue()
+		return MapEntry{Key: key, Value: value}, err
+	default:
+		return nil, fmt.Errorf("unsupported tag: %d", tag)
+	}
+}
+
+func (d *Decoder) readInputDocument() (*InputDocument, error) {
+	size, err := d.readVInt()
+	if err != nil {
+		return nil, err
+	}
+	v, err := d.readValue()
+	if err != nil {
+		return nil, err
+	}
+	boost, ok := v.(float32)
+	if !ok {
+		return nil, fmt.Errorf("invalid document boost: %v", v)
+	}
+	// each entry is a field, or an anonymous child document
+	doc := &InputDocument{Boost: boost, Fields: make([]Entry, 0, min(size, 1024))}
+	for range size {
+		v, err := d.readValue()
+		if err != nil {
+			return nil, err
+		}
+		if child, ok := v.(*InputDocument); ok {
+			doc.Children = append(doc.Children, child)
+			continue
+		}
+		key, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, but got %T", v)
+		}
+		value, err := d.readValue()
+		if err != nil {
+			return nil, err
+		}
+		doc.Fields = append(doc.Fields, Entry{Key: key, Value: value})
+	}
+	return doc, nil
+}
+
+func (d *Decoder) readEntries(size int) ([]Entry, error) {
+	entries := make([]Entry, 0, min(size, 1024))
+	for range size {
+		key, err := d.readKey()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.readValue()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Key: key, Value: v})
+	}
+	return entries, nil
+}
+
+// readKey reads a string value such as a name of NamedList.
+func (d *Decoder) readKey() (string, error) {
+	v, err := d.readValue()
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected string, but got %T", v)
+	}
+	return s, nil
+}
+
+func (d *Decoder) readString(tag byte) (string, error) {
+	size, err := d.readSize(tag)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// readSmallInt reads SINT and SLONG: the lower 4 bits of the tag,
+// followed by a variable-length integer of the other bits if the 5th bit is set.
+func (d *Decoder) readSmallInt(tag byte) (int64, error) {
+	i := int64(tag & 0x0f)
+	if tag&0x10 == 0 {
+		return i, nil
+	}
+	rest, err := d.readVLong()
+	if err != nil {
+		return 0, err
+	}
+	return rest<<4 | i, nil
+}
+
+func (d *Decoder) readSize(tag byte) (int, error) {
+	size := int(tag & 0x1f)
+	if size == 0x1f {
+		rest, err := d.readVInt()
+		if err != nil {
+			return 0, err
+		}
+		size += rest
+	}
+	return size, nil
+}
+
+func (d *Decoder) readVInt() (int, error) {
+	i, err := d.readVLong()
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid size: %d", i)
+	}
+	return int(i), nil
+}
+
+func (d *Decoder) readVLong() (int64, error) {
+	var i int64
+	for shift := 0; shift < 64; shift += 7 {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		i |= int64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return i, nil
+		}
+	}
+	return 0, errors.New("variable-length integer is too long")
+}
+
+func (d *Decoder) readLong() (int64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf[:])), nil
+}
@@ -0,0 +1,256 @@
+package javabin
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppendTag appends the tag and the size of a value.
+// The size of a tag with the size bits (e.g. STR, ARR) is packed into the tag if it fits,
+// and the size of the other tags (e.g. MAP) is written as a variable-length integer.
+func AppendTag(b []byte, tag byte, size int) []byte {
+	if tag&0xe0 == 0 {
+		return appendVInt(append(b, tag), size)
+	}
+	if size < 0x1f {
+		return append(b, tag|byte(size))
+	}
+	return appendVInt(append(b, tag|0x1f), size-0x1f)
+}
+
+// appendVInt appends a variable-length integer, 7 bits per byte from the lowest.
+func appendVInt(b []byte, i int) []byte {
+	u := uint32(i)
+	for u&^0x7f != 0 {
+		b = append(b, byte(u&0x7f|0x80))
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+// AppendString appends s as STR.
+// Invalid UTF-8 sequences are replaced with U+FFFD.
+func AppendString(b []byte, s string) []byte {
+	s = strings.ToValidUTF8(s, "�")
+	b = AppendTag(b, tagStr, len(s))
+	return append(b, s...)
+}
+
+// AppendExternString appends s as EXTERN_STRING, which SolrJ writes names as.
+// s is always written as a new string of the stream, not a reference to the same string written before,
+// so that values can be written independently and joined into a stream.
+func AppendExternString(b []byte, s string) []byte {
+	return AppendString(append(b, tagExternString), s)
+}
+
+// AppendNull appends null.
+func AppendNull(b []byte) []byte {
+	return append(b, tagNull)
+}
+
+// AppendIteratorStart appends the start of an iterator. Values follow it until AppendEnd.
+func AppendIteratorStart(b []byte) []byte {
+	return append(b, tagIterator)
+}
+
+// AppendEnd appends the end of an iterator.
+func AppendEnd(b []byte) []byte {
+	return append(b, tagEnd)
+}
+
+// AppendNamedListStart appends the start of a named list of size entries.
+func AppendNamedListStart(b []byte, size int) []byte {
+	return AppendTag(b, tagNamedList, size)
+}
+
+// AppendOrderedMapStart appends the start of an ordered map (SimpleOrderedMap) of size entries,
+// a named list that SolrJ writes parameters as.
+func AppendOrderedMapStart(b []byte, size int) []byte {
+	return AppendTag(b, tagOrderedMap, size)
+}
+
+// AppendValue appends v.
+// Integers are written as INT or LONG, or SINT and SLONG if they are small and not negative as SolrJ does,
+// and integers out of the range of long (e.g. *big.Int) as STR.
+// Names of NamedList, keys of Map and field names are written as EXTERN_STRING.
+// Strings, time.Time (DATE), slices (ARR) and the types of the package are supported,
+// and pointers are written as the values they point to.
+func AppendValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return AppendNull(b), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendLong(b, i), nil
+		}
+		if f, err := v.Float64(); err == nil {
+			return appendDouble(b, f), nil
+		}
+		return nil, fmt.Errorf("invalid number: %q", string(v))
+	case *big.Int:
+		if v == nil {
+			return AppendNull(b), nil
+		}
+		if v.IsInt64() {
+			return appendLong(b, v.Int64()), nil
+		}
+		return AppendString(b, v.String()), nil
+	case *big.Float:
+		if v == nil {
+			return AppendNull(b), nil
+		}
+		f, _ := v.Float64()
+		return appendDouble(b, f), nil
+	case time.Time:
+		b = append(b, tagDate)
+		return binary.BigEndian.AppendUint64(b, uint64(v.UnixMilli())), nil
+	case NamedList:
+		return appendEntries(AppendTag(b, tagNamedList, len(v)), v)
+	case Map:
+		return appendEntries(AppendTag(b, tagMap, len(v)), v)
+	case Iterator:
+		b = AppendIteratorStart(b)
+		for _, x := range v {
+			var err error
+			if b, err = AppendValue(b, x); err != nil {
+				return nil, err
+			}
+		}
+		return AppendEnd(b), nil
+	case MapEntry:
+		b = append(b, tagMapEntry)
+		b, err := AppendValue(b, v.Key)
+		if err != nil {
+			return nil, err
+		}
+		return AppendValue(b, v.Value)
+	case *InputDocument:
+		return AppendInputDocument(b, v)
+	case []byte:
+		b = AppendTag(b, tagByteArr, len(v))
+		return append(b, v...), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return AppendNull(b), nil
+		}
+		return AppendValue(b, rv.Elem().Interface())
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(b, tagBoolTrue), nil
+		}
+		return append(b, tagBoolFalse), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return appendInt(b, int32(rv.Int())), nil
+	case reflect.Int, reflect.Int64:
+		return appendLong(b, rv.Int()), nil
+	case reflect.Uint8, reflect.Uint16:
+		return appendInt(b, int32(rv.Uint())), nil
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return AppendString(b, strconv.FormatUint(u, 10)), nil
+		}
+		return appendLong(b, int64(u)), nil
+	case reflect.Float32:
+		return appendFloat(b, float32(rv.Float())), nil
+	case reflect.Float64:
+		return appendDouble(b, rv.Float()), nil
+	case reflect.String:
+		return AppendString(b, rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		b = AppendTag(b, tagArr, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			var err error
+			if b, err = AppendValue(b, rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+// AppendInputDocument appends doc as SOLRINPUTDOC.
+// The fields are followed by the anonymous child documents.
+func AppendInputDocument(b []byte, doc *InputDocument) ([]byte, error) {
+	b = AppendTag(b, tagInputDoc, len(doc.Fields)+len(doc.Children))
+	b = appendFloat(b, doc.Boost)
+	for _, field := range doc.Fields {
+		b = AppendExternString(b, field.Key)
+		var err error
+		if b, err = AppendValue(b, field.Value); err != nil {
+			return nil, fmt.Errorf("field %q: %w", field.Key, err)
+		}
+	}
+	for i, child := range doc.Children {
+		var err error
+		if b, err = AppendInputDocument(b, child); err != nil {
+			return nil, fmt.Errorf("child document %d: %w", i, err)
+		}
+	}
+	return b, nil
+}
+
+func appendEntries(b []byte, entries []Entry) ([]byte, error) {
+	for _, e := range entries {
+		b = AppendExternString(b, e.Key)
+		var err error
+		if b, err = AppendValue(b, e.Value); err != nil {
+			return nil, fmt.Errorf("%q: %w", e.Key, err)
+		}
+	}
+	return b, nil
+}
+
+// appendInt appends a positive int as SINT, and the others as INT.
+func appendInt(b []byte, i int32) []byte {
+	if i > 0 {
+		return appendSmallInt(b, tagSInt, uint64(i))
+	}
+	b = append(b, tagInt)
+	return binary.BigEndian.AppendUint32(b, uint32(i))
+}
+
+// appendLong appends a long within 56 bits as SLONG, and the others as LONG.
+func appendLong(b []byte, i int64) []byte {
+	if uint64(i)&0xff00000000000000 == 0 {
+		return appendSmallInt(b, tagSLong, uint64(i))
+	}
+	b = append(b, tagLong)
+	return binary.BigEndian.AppendUint64(b, uint64(i))
+}
+
+// appendSmallInt appends the lower 4 bits of u in the tag,
+// followed by a variable-length integer of the other bits if u does not fit in them.
+func appendSmallInt(b []byte, tag byte, u uint64) []byte {
+	if u < 0x0f {
+		return append(b, tag|byte(u))
+	}
+	b = append(b, tag|0x10|byte(u&0x0f))
+	for u >>= 4; u&^0x7f != 0; u >>= 7 {
+		b = append(b, byte(u&0x7f|0x80))
+	}
+	return append(b, byte(u))
+}
+
+func appendFloat(b []byte, f float32) []byte {
+	b = append(b, tagFloat)
+	return binary.BigEndian.AppendUint32(b, math.Float32bits(f))
+}
+
+func appendDouble(b []byte, f float64) []byte {
+	b = append(b, tagDouble)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+}
@@ -0,0 +1,79 @@
+// Package javabin implements javabin, the binary format of Solr (JavaBinCodec).
+package javabin
+
+// Version is the version of the format written at the beginning of a stream.
+const Version = 2
+
+// Tags of values.
+const (
+	tagNull        = 0
+	tagBoolTrue    = 1
+	tagBoolFalse   = 2
+	tagByte        = 3
+	tagShort       = 4
+	tagDouble      = 5
+	tagInt         = 6
+	tagLong        = 7
+	tagFloat       = 8
+	tagDate        = 9
+	tagMap         = 10
+	tagSolrDoc     = 11
+	tagSolrDocList = 12
+	tagByteArr     = 13
+	tagIterator    = 14
+	tagEnd         = 15
+	tagInputDoc    = 16
+	tagMapEntry    = 19
+)
+
+// Tags with the size in the lower 5 bits.
+const (
+	tagStr          = 1 << 5
+	tagSInt         = 2 << 5
+	tagSLong        = 3 << 5
+	tagArr          = 4 << 5
+	tagOrderedMap   = 5 << 5
+	tagNamedList    = 6 << 5
+	tagExternString = 7 << 5
+)
+
+// Entry is a named value of NamedList, Map and InputDocument.
+type Entry struct {
+	Key   string
+	Value interface{}
+}
+
+// NamedList is an ordered list of named values (org.apache.solr.common.util.NamedList).
+// Names may be duplicated.
+type NamedList []Entry
+
+// Get returns the first value of the name.
+func (n NamedList) Get(name string) (interface{}, bool) {
+	for _, e := range n {
+		if e.Key == name {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Map is a map (java.util.Map) whose entries are written in order.
+type Map []Entry
+
+// MapEntry is an entry of a map written by itself (java.util.Map.Entry),
+// such as a document and its parameters in "docsMap" of an update request.
+type MapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Iterator is a list of values written as an iterator, whose size is not written ahead.
+type Iterator []interface{}
+
+// InputDocument is a document of an update request (org.apache.solr.common.SolrInputDocument).
+// Children are anonymous child documents, and labeled child documents are field values.
+type InputDocument struct {
+	Boost    float32
+	Fields   []Entry
+	Children []*InputDocument
+}
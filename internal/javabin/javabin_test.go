@@ -0,0 +1,179 @@
+package javabin_test
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/javabin"
+)
+
+func TestAppendValue(t *testing.T) {
+	long := strings.Repeat("a", 40)
+
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected []byte
+	}{
+		{name: "null", value: nil, expected: []byte{0}},
+		{name: "true", value: true, expected: []byte{1}},
+		{name: "false", value: false, expected: []byte{2}},
+		{name: "small int", value: int32(1), expected: []byte{0x41}},
+		{name: "small int with variable-length", value: int32(300), expected: []byte{0x5c, 0x12}},
+		{name: "zero int", value: int32(0), expected: []byte{6, 0, 0, 0, 0}},
+		{name: "negative int", value: int16(-2), expected: []byte{6, 0xff, 0xff, 0xff, 0xfe}},
+		{name: "small long", value: 258, expected: []byte{0x72, 0x10}},
+		{name: "zero long", value: 0, expected: []byte{0x60}},
+		{name: "long", value: int64(1) << 56, expected: []byte{7, 1, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "negative long", value: -1, expected: []byte{7, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "float", value: float32(1), expected: []byte{8, 0x3f, 0x80, 0, 0}},
+		{name: "double", value: 1.0, expected: []byte{5, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}},
+		{name: "date", value: time.UnixMilli(1000).In(time.FixedZone("JST", 9*60*60)), expected: []byte{9, 0, 0, 0, 0, 0, 0, 0x03, 0xe8}},
+		{name: "string", value: "abc", expected: []byte{0x23, 'a', 'b', 'c'}},
+		{name: "long string", value: long, expected: append([]byte{0x3f, 40 - 0x1f}, long...)},
+		{name: "invalid utf-8", value: "a\xff", expected: []byte{0x24, 'a', 0xef, 0xbf, 0xbd}},
+		{name: "unsigned out of range of long", value: uint64(math.MaxUint64), expected: append([]byte{0x34}, "18446744073709551615"...)},
+		{name: "array", value: []string{"a", "b"}, expected: []byte{0x82, 0x21, 'a', 0x21, 'b'}},
+		{name: "map", value: javabin.Map{{Key: "set", Value: nil}}, expected: []byte{10, 1, 0xe0, 0x23, 's', 'e', 't', 0}},
+		{name: "named list", value: javabin.NamedList{{Key: "a", Value: true}}, expected: []byte{0xc1, 0xe0, 0x21, 'a', 1}},
+		{name: "iterator", value: javabin.Iterator{nil, true}, expected: []byte{14, 0, 1, 15}},
+		{name: "map entry", value: javabin.MapEntry{Key: "a", Value: nil}, expected: []byte{19, 0x21, 'a', 0}},
+		{
+			name:     "input document",
+			value:    &javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{{Key: "id", Value: "1"}}},
+			expected: []byte{16, 1, 8, 0x3f, 0x80, 0, 0, 0xe0, 0x22, 'i', 'd', 0x21, '1'},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := javabin.AppendValue(nil, c.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, c.expected) {
+				t.Fatalf("\nexpected: %v\n but got: %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestAppendTag(t *testing.T) {
+	// MAP writes the size as a variable-length integer after the tag
+	if got, expected := javabin.AppendTag(nil, 10, 300), []byte{10, 0xac, 0x02}; !bytes.Equal(got, expected) {
+		t.Fatalf("\nexpected: %v\n but got: %v", expected, got)
+	}
+}
+
+func TestDecoder_ReadValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     []byte
+		expected interface{}
+	}{
+		{name: "small int", data: []byte{0x45}, expected: int32(5)},
+		{name: "small int with variable-length", data: []byte{0x5c, 0x12}, expected: int32(300)},
+		{name: "small long", data: []byte{0x7c, 0x12}, expected: int64(300)},
+		{name: "byte", data: []byte{3, 0xff}, expected: int8(-1)},
+		{name: "short", data: []byte{4, 0x01, 0x00}, expected: int16(256)},
+		{name: "byte array", data: []byte{13, 2, 0xca, 0xfe}, expected: []byte{0xca, 0xfe}},
+		{
+			name:     "extern strings",
+			data:     []byte{0x82, 0xe0, 0x21, 'a', 0xe1},
+			expected: []interface{}{"a", "a"},
+		},
+		{
+			name:     "ordered map",
+			data:     []byte{0xa1, 0x21, 'a', 0x41},
+			expected: javabin.NamedList{{Key: "a", Value: int32(1)}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := javabin.NewDecoder(bytes.NewReader(c.data)).ReadValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Fatalf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC)
+	value := javabin.NamedList{
+		{Key: "params", Value: javabin.NamedList{}},
+		{Key: "delByQ", Value: nil},
+		{Key: "docs", Value: javabin.Iterator{
+			&javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{
+				{Key: "id", Value: "1"},
+				{Key: "str_s", Value: "日本語"},
+				{Key: "count_i", Value: int32(10)},
+				{Key: "big_i", Value: int32(math.MaxInt32)},
+				{Key: "zero_l", Value: int64(0)},
+				{Key: "big_l", Value: int64(math.MaxInt64)},
+				{Key: "price_l", Value: int64(math.MinInt64)},
+				{Key: "ratio_f", Value: float32(0.5)},
+				{Key: "score_d", Value: math.Inf(-1)},
+				{Key: "flag_b", Value: true},
+				{Key: "created_dt", Value: date},
+				{Key: "tags_ss", Value: []interface{}{"a", "b"}},
+				{Key: "nums_is", Value: []interface{}{int32(1), int64(2)}},
+				{Key: "atomic", Value: javabin.Map{{Key: "inc", Value: int64(-1)}, {Key: "set", Value: nil}}},
+				{Key: "long_s", Value: strings.Repeat("x", 1000)},
+				{Key: "comments", Value: []interface{}{
+					&javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{{Key: "id", Value: "1-c1"}}},
+				}},
+			}, Children: []*javabin.InputDocument{
+				{Boost: 1, Fields: []javabin.Entry{{Key: "id", Value: "1-1"}}},
+			}},
+		}},
+		{Key: "delById", Value: javabin.Iterator{"2", "3"}},
+		{Key: "docsMap", Value: javabin.Iterator{
+			javabin.MapEntry{Key: &javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{{Key: "id", Value: "4"}}}, Value: nil},
+		}},
+	}
+
+	data, err := javabin.AppendValue([]byte{javabin.Version}, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := javabin.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(interface{}(value), got); diff != "" {
+		t.Fatalf("(-expected, +got)\n%s", diff)
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "unsupported version", data: []byte{1, 0}},
+		{name: "truncated", data: []byte{2, 7, 0, 0}},
+		{name: "unexpected end", data: []byte{2, 15}},
+		{name: "trailing data", data: []byte{2, 0, 0}},
+		{name: "unknown extern string", data: []byte{2, 0xe1}},
+		{name: "non-string name", data: []byte{2, 0xc1, 0, 0}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got, err := javabin.Unmarshal(c.data); err == nil {
+				t.Fatalf("expected error, but got %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package solr
+
+import (
+	"iter"
+	"strings"
+)
+
+// BatchLimit limits the size of an update request.
+// Zero means no limit.
+type BatchLimit struct {
+	MaxDocs  int
+	MaxBytes int
+}
+
+// Batches splits the update request into bodies within limit.
+// Each body is a well-formed update request, and deletes are sent after all adds as Build does.
+// A document larger than MaxBytes can not be split, so it is sent in a body by itself.
+func (u *UpdateBatchBuilder) Batches(limit BatchLimit) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		deletes, err := u.deletes()
+		if err != nil {
+			yield("", err)
+			return
+		}
+		b := batch{limit: limit, layout: u.encoder.Layout()}
+
+		// push adds the item to the batch, and yields the batch first if the item does not fit.
+		push := func(kind batchItem, item string) bool {
+			if !b.empty() && !b.fits(b.sizeWith(kind, item)) {
+				if !yield(b.String(), nil) {
+					return false
+				}
+				b.reset()
+			}
+			b.add(kind, item)
+			return true
+		}
+
+		for merged := range u.updates() {
+			add, err := u.encodeAdd(merged)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if !push(batchAdd, add) {
+				return
+			}
+		}
+
+		for doc := range deletes.Iter() {
+			if !push(batchDeleteID, u.encoder.EncodeDeleteID(doc.ID)) {
+				return
+			}
+		}
+
+		for _, query := range u.DeleteQueries {
+			q, err := u.encoder.EncodeDeleteQuery(query)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if !push(batchDeleteQuery, q) {
+				return
+			}
+		}
+
+		if !b.empty() {
+			yield(b.String(), nil)
+		}
+	}
+}
+
+type batchItem int
+
+const (
+	batchAdd batchItem = iota
+	batchDeleteID
+	batchDeleteQuery
+)
+
+// batch is an update request body being built.
+type batch struct {
+	limit  BatchLimit
+	layout Layout
+
+	adds    []string // encoded add commands
+	ids     []string // encoded ids
+	queries []string // encoded queries
+	size    int      // size of String()
+}
+
+func (b *batch) empty() bool {
+	return b.docs() == 0
+}
+
+func (b *batch) reset() {
+	b.adds = b.adds[:0]
+	b.ids = b.ids[:0]
+	b.queries = b.queries[:0]
+	b.size = 0
+}
+
+func (b *batch) docs() int {
+	return len(b.adds) + len(b.ids) + len(b.queries)
+}
+
+// parts returns the number of parts joined by the separator: adds and non-empty groups.
+func (b *batch) parts() int {
+	parts := len(b.adds)
+	if len(b.ids) > 0 {
+		parts++
+	}
+	if len(b.queries) > 0 {
+		parts++
+	}
+	return parts
+}
+
+func (b *batch) fits(size int) bool {
+	if b.limit.MaxDocs > 0 && b.docs()+1 > b.limit.MaxDocs {
+		return false
+	}
+	if b.limit.MaxBytes > 0 && size > b.limit.MaxBytes {
+		return false
+	}
+	return true
+}
+
+func (b *batch) currentSize() int {
+	if b.empty() {
+		return len(b.layout.Begin) + len(b.layout.DeleteByID.Empty) + len(b.layout.DeleteByQuery.Empty) + len(b.layout.End)
+	}
+	return b.size
+}
+
+// sizeWith returns the size of String() with the item.
+func (b *batch) sizeWith(kind batchItem, item string) int {
+	size := b.currentSize() + len(item)
+
+	var (
+		group Group
+		items []string
+	)
+	switch kind {
+	case batchAdd:
+		if b.parts() > 0 {
+			size += len(b.layout.Separator)
+		}
+		return size
+	case batchDeleteID:
+		group, items = b.layout.DeleteByID, b.ids
+	case batchDeleteQuery:
+		group, items = b.layout.DeleteByQuery, b.queries
+	}
+
+	if len(items) > 0 {
+		return size + len(group.Separator)
+	}
+	// the group replaces the empty group
+	size += len(group.Begin) + len(group.End) - len(group.Empty)
+	if b.parts() > 0 {
+		size += len(b.layout.Separator)
+	}
+	return size
+}
+
+func (b *batch) add(kind batchItem, item string) {
+	b.size = b.sizeWith(kind, item)
+	switch kind {
+	case batchAdd:
+		b.adds = append(b.adds, item)
+	case batchDeleteID:
+		b.ids = append(b.ids, item)
+	case batchDeleteQuery:
+		b.queries = append(b.queries, item)
+	}
+}
+
+func (b *batch) String() string {
+	var buf strings.Builder
+	buf.Grow(b.currentSize())
+
+	buf.WriteString(b.layout.Begin)
+	buf.WriteString(strings.Join(b.adds, b.layout.Separator))
+	first := len(b.adds) == 0
+	for _, g := range []struct {
+		group Group
+		items []string
+	}{
+		{b.layout.DeleteByID, b.ids},
+		{b.layout.DeleteByQuery, b.queries},
+	} {
+		if len(g.items) == 0 {
+			buf.WriteString(g.group.Empty)
+			continue
+		}
+		if !first {
+			buf.WriteString(b.layout.Separator)
+		}
+		first = false
+		buf.WriteString(g.group.Begin)
+		buf.WriteString(strings.Join(g.items, g.group.Separator))
+		buf.WriteString(g.group.End)
+	}
+	buf.WriteString(b.layout.End)
+	return buf.String()
+}
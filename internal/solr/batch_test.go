@@ -0,0 +1,131 @@
+package solr_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestUpdateBatchBuilder_Batches(t *testing.T) {
+	docs := []solr.Document{
+		{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}},
+		{ID: "2", Fields: []solr.Field{{Key: "str1", Value: "b"}}},
+		{ID: "3", Fields: []solr.Field{{Key: "str1", Value: "c"}}},
+	}
+	deletes := []solr.Document{
+		{ID: "11"},
+		{ID: "12"},
+	}
+
+	cases := []struct {
+		name string
+
+		add     []solr.Document
+		delete  []solr.Document
+		queries []solr.DeleteQuery
+		limit   solr.BatchLimit
+
+		expected []string
+	}{
+		{
+			name:     "nothing documents",
+			limit:    solr.BatchLimit{MaxDocs: 2},
+			expected: []string{},
+		},
+		{
+			name:   "no limit",
+			add:    docs,
+			delete: deletes,
+			limit:  solr.BatchLimit{},
+			expected: []string{
+				`{` +
+					`"add":{"doc":{"id":"1","str1":"a"}}` +
+					`,"add":{"doc":{"id":"2","str1":"b"}}` +
+					`,"add":{"doc":{"id":"3","str1":"c"}}` +
+					`,"delete":["11","12"]` +
+					`}`,
+			},
+		},
+		{
+			name:   "max docs",
+			add:    docs,
+			delete: deletes,
+			limit:  solr.BatchLimit{MaxDocs: 2},
+			expected: []string{
+				`{"add":{"doc":{"id":"1","str1":"a"}},"add":{"doc":{"id":"2","str1":"b"}}}`,
+				`{"add":{"doc":{"id":"3","str1":"c"}},"delete":["11"]}`,
+				`{"delete":["12"]}`,
+			},
+		},
+		{
+			name:   "max bytes",
+			add:    docs,
+			delete: deletes,
+			// `{"add":{"doc":{"id":"1","str1":"a"}},"add":{"doc":{"id":"2","str1":"b"}}}` is 75 bytes
+			limit: solr.BatchLimit{MaxBytes: 75},
+			expected: []string{
+				`{"add":{"doc":{"id":"1","str1":"a"}},"add":{"doc":{"id":"2","str1":"b"}}}`,
+				`{"add":{"doc":{"id":"3","str1":"c"}},"delete":["11","12"]}`,
+			},
+		},
+		{
+			name:    "delete by query",
+			add:     docs[:1],
+			delete:  deletes,
+			queries: []solr.DeleteQuery{{Query: "str1:x"}, {Query: "str1:y", Route: "a!"}},
+			limit:   solr.BatchLimit{MaxDocs: 2},
+			expected: []string{
+				`{"add":{"doc":{"id":"1","str1":"a"}},"delete":["11"]}`,
+				`{"delete":["12"],"delete":{"query":"str1:x"}}`,
+				`{"delete":{"query":"str1:y","_route_":"a!"}}`,
+			},
+		},
+		{
+			name:    "delete by query with max bytes",
+			queries: []solr.DeleteQuery{{Query: "str1:x"}, {Query: "str1:y"}, {Query: "str1:z"}},
+			// `{"delete":{"query":"str1:x"},"delete":{"query":"str1:y"}}` is 57 bytes
+			limit: solr.BatchLimit{MaxBytes: 57},
+			expected: []string{
+				`{"delete":{"query":"str1:x"},"delete":{"query":"str1:y"}}`,
+				`{"delete":{"query":"str1:z"}}`,
+			},
+		},
+		{
+			name: "document larger than max bytes",
+			add:  docs[:2],
+			limit: solr.BatchLimit{
+				MaxBytes: 10,
+			},
+			expected: []string{
+				`{"add":{"doc":{"id":"1","str1":"a"}}}`,
+				`{"add":{"doc":{"id":"2","str1":"b"}}}`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(nil, nil)
+			builder.Add(c.add...)
+			builder.Delete(c.delete...)
+			builder.DeleteByQuery(c.queries...)
+
+			got := make([]string, 0)
+			for body, err := range builder.Batches(c.limit) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !json.Valid([]byte(body)) {
+					t.Fatalf("invalid json: %s", body)
+				}
+				got = append(got, body)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Fatalf("diff: %s", diff)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package solr
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
 	"strings"
 
 	"github.com/imishinist/solr-inplace-poc/internal/myiter"
@@ -8,25 +13,165 @@ import (
 
 type UpdateBatchBuilder struct {
 	// configuration
-	fields              []string
-	inPlaceUpdateFields []string
+	policy           Policy
+	operations       map[string]Operation
+	removeWithNull   bool
+	optimistic       bool
+	encoder          Encoder
+	syncMode         SyncMode
+	maxDeletePercent float64
 
 	// states
 	OldDocuments    DocSet // old documents for in-place update
 	Documents       DocSet
 	DeleteDocuments DocSet
+	DeleteQueries   []DeleteQuery // in insertion order
 }
 
+// SyncMode is how old documents that are not in the new documents are handled.
+type SyncMode int
+
+const (
+	// SyncPartial treats the new documents as a partial feed, and ignores the old documents that are not in them.
+	SyncPartial SyncMode = iota
+	// SyncFull treats the new documents as the full snapshot, and deletes the old documents that are not in them.
+	SyncFull
+)
+
+// ParseSyncMode parses "partial" or "full".
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch s {
+	case "partial":
+		return SyncPartial, nil
+	case "full":
+		return SyncFull, nil
+	default:
+		return SyncPartial, fmt.Errorf("unknown sync mode: %q", s)
+	}
+}
+
+// DeleteQuery is a delete-by-query command.
+type DeleteQuery struct {
+	Query string `json:"query"`
+	// Route is the _route_ of the query in SolrCloud if it is not empty.
+	Route string `json:"_route_,omitempty"`
+	// Version is the _version_ of the query if it is not zero.
+	Version int64 `json:"_version_,omitempty"`
+}
+
+// NewUpdateBatchBuilder returns the builder with the policy of allowed fields and in-place update fields.
+// See PolicyFromFields.
 func NewUpdateBatchBuilder(fields []string, inPlaceUpdateFields []string) *UpdateBatchBuilder {
+	return NewUpdateBatchBuilderWithPolicy(PolicyFromFields(fields, inPlaceUpdateFields))
+}
+
+// NewUpdateBatchBuilderWithPolicy returns the builder that compares and updates fields by the policy.
+func NewUpdateBatchBuilderWithPolicy(policy Policy) *UpdateBatchBuilder {
 	return &UpdateBatchBuilder{
-		fields:              fields,
-		inPlaceUpdateFields: inPlaceUpdateFields,
-		OldDocuments:        make(DocSet),
-		Documents:           make(DocSet),
-		DeleteDocuments:     make(DocSet),
+		policy:          policy,
+		operations:      make(map[string]Operation),
+		encoder:         JSONEncoder{},
+		OldDocuments:    make(DocSet),
+		DeleteDocuments: make(DocSet),
+		Documents:       make(DocSet),
+	}
+}
+
+// SetOperation sets the atomic update operation used for the field, overriding the operation of its policy.
+// The field can be updated partially even if its policy is PolicyReindex.
+// removeregex can not be computed from the difference.
+func (u *UpdateBatchBuilder) SetOperation(field string, op Operation) error {
+	switch op {
+	case OpSet, OpInc, OpAdd, OpAddDistinct, OpRemove:
+	default:
+		return fmt.Errorf("operation %q is not supported for field %q", op, field)
+	}
+	u.operations[field] = op
+	return nil
+}
+
+// SetRemoveWithNull sets whether removed fields are updated partially with {"set":null}.
+// If it is disabled, a document that has removed fields is always fully re-indexed,
+// except for the fields of PolicyRemoveIfEmpty.
+// In-place update fields (docValues only fields) can not be removed by atomic updates,
+// so a document whose in-place update field is removed is fully re-indexed in either case.
+func (u *UpdateBatchBuilder) SetRemoveWithNull(enabled bool) {
+	u.removeWithNull = enabled
+}
+
+// canRemovePartially reports whether the removed field can be removed by {"set":null}.
+func (u *UpdateBatchBuilder) canRemovePartially(field string) bool {
+	switch u.policy.Of(field) {
+	case PolicyRemoveIfEmpty:
+		return true
+	case PolicyInPlace:
+		return false
+	default:
+		return u.removeWithNull
+	}
+}
+
+// SetOptimisticConcurrency sets whether updates are conditional on the _version_ of the old documents.
+// If it is enabled, the _version_ of the old document is sent with the update of the document,
+// and Solr rejects the update if the document has been changed since the old document was taken.
+// Documents without old documents are sent unconditionally.
+// The _version_ of new documents is never sent.
+func (u *UpdateBatchBuilder) SetOptimisticConcurrency(enabled bool) {
+	u.optimistic = enabled
+}
+
+// SetEncoder sets the encoder of update requests. The default is JSONEncoder.
+func (u *UpdateBatchBuilder) SetEncoder(encoder Encoder) {
+	u.encoder = encoder
+}
+
+// ContentType returns the Content-Type of the update requests built by the builder.
+func (u *UpdateBatchBuilder) ContentType() string {
+	return u.encoder.ContentType()
+}
+
+// SetSyncMode sets how the old documents that are not in the new documents are handled. The default is SyncPartial.
+func (u *UpdateBatchBuilder) SetSyncMode(mode SyncMode) {
+	u.syncMode = mode
+}
+
+// SetMaxDeletePercent sets the safety threshold of SyncFull.
+// Build fails if more than percent of the old documents would be deleted, e.g. by a truncated snapshot.
+// Zero means no limit.
+func (u *UpdateBatchBuilder) SetMaxDeletePercent(percent float64) {
+	u.maxDeletePercent = percent
+}
+
+func (u *UpdateBatchBuilder) operation(field string) Operation {
+	if op, ok := u.operations[field]; ok {
+		return op
+	}
+	return u.policy.Of(field).operation()
+}
+
+// allowed reports whether the field is allowed to be updated, that is, it is not ignored.
+func (u *UpdateBatchBuilder) allowed(field string) bool {
+	return u.policy.Of(field) != PolicyIgnore
+}
+
+// triggers reports whether a change of the field is an update of the document by itself.
+func (u *UpdateBatchBuilder) triggers(field string) bool {
+	switch u.policy.Of(field) {
+	case PolicyIgnore, PolicyPassive:
+		return false
+	default:
+		return true
 	}
 }
 
+// canUpdatePartially reports whether the field can be updated by an atomic update.
+func (u *UpdateBatchBuilder) canUpdatePartially(field string) bool {
+	if _, ok := u.operations[field]; ok {
+		return true
+	}
+	return u.policy.Of(field).partial()
+}
+
 func (u *UpdateBatchBuilder) Add(docs ...Document) {
 	for _, doc := range docs {
 		u.Documents.Add(doc)
@@ -50,111 +195,255 @@ func (u *UpdateBatchBuilder) Delete(docs ...Document) {
 	}
 }
 
+// DeleteByQuery adds delete-by-query commands.
+// They are sent after the deletes by id, in the order they are added.
+func (u *UpdateBatchBuilder) DeleteByQuery(queries ...DeleteQuery) {
+	u.DeleteQueries = append(u.DeleteQueries, queries...)
+}
+
 func (u *UpdateBatchBuilder) Build() (string, error) {
+	var buf strings.Builder
+	if err := u.BuildTo(&buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// BuildTo writes the update request body to w.
+// Documents are encoded one by one, so the encoded body is never held in memory as a whole.
+// The documents themselves are held in the builder, so the memory grows with the input.
+func (u *UpdateBatchBuilder) BuildTo(w io.Writer) error {
+	deletes, err := u.deletes()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
 	var (
-		builder queryBuilder
+		builder = newQueryBuilder(bw)
+		layout  = u.encoder.Layout()
 		first   = true
 	)
-	builder.WriteString("{")
-
-	mergedIter := NewMergedDocSetIterator(u.OldDocuments.Iter(), u.Documents.Iter())
-	for merged := range mergedIter.Iter() {
-		if !u.hasUpdates(merged.Left, merged.Right) {
-			continue
-		}
+	builder.WriteString(layout.Begin)
 
+	for merged := range u.updates() {
 		// write
 		if !first {
-			builder.WriteString(",")
+			builder.WriteString(layout.Separator)
 		}
 		first = false
 
-		builder.WriteString(`"add":{"doc":`)
-		if err := u.encodeDoc(&builder, merged); err != nil {
-			return "", err
+		add, err := u.encodeAdd(merged)
+		if err != nil {
+			return err
 		}
-		builder.WriteString("}")
+		builder.WriteString(add)
 	}
 
-	if len(u.DeleteDocuments) > 0 {
+	if len(deletes) > 0 {
 		if !first {
-			builder.WriteString(",")
+			builder.WriteString(layout.Separator)
 		}
+		first = false
+		u.encodeDelete(builder, layout.DeleteByID, deletes)
+	} else {
+		builder.WriteString(layout.DeleteByID.Empty)
+	}
 
-		builder.WriteString(`"delete":`)
-		if err := u.encodeDelete(&builder); err != nil {
-			return "", err
+	if len(u.DeleteQueries) > 0 {
+		if !first {
+			builder.WriteString(layout.Separator)
 		}
+		if err := u.encodeDeleteQueries(builder, layout.DeleteByQuery); err != nil {
+			return err
+		}
+	} else {
+		builder.WriteString(layout.DeleteByQuery.Empty)
 	}
-	builder.WriteString("}")
+	builder.WriteString(layout.End)
 
 	if err := builder.Error(); err != nil {
-		return "", err
+		return err
+	}
+	return bw.Flush()
+}
+
+// updates iterates the merged documents that have updates.
+// Old documents that are not in the new documents are not updates, see deletes.
+func (u *UpdateBatchBuilder) updates() iter.Seq[myiter.Merged[Document]] {
+	return func(yield func(myiter.Merged[Document]) bool) {
+		mergedIter := NewMergedDocSetIterator(u.OldDocuments.Iter(), u.Documents.Iter())
+		for merged := range mergedIter.Iter() {
+			if merged.Right == nil {
+				continue
+			}
+			if !u.hasUpdates(merged.Left, merged.Right) {
+				continue
+			}
+			if !yield(merged) {
+				return
+			}
+		}
 	}
-	return builder.String(), nil
 }
 
+// encodeAdd encodes the add command of the merged document.
+func (u *UpdateBatchBuilder) encodeAdd(merged myiter.Merged[Document]) (string, error) {
+	doc, atomic := u.addDocument(merged)
+	return u.encoder.EncodeAdd(doc, atomic)
+}
+
+// addDocument returns the document to be added. atomic reports whether it is an atomic update.
+//
 // MergedDoc:
 //
 //	Left: old document
 //	right: new document
-func (u *UpdateBatchBuilder) encodeDoc(builder *queryBuilder, merged myiter.Merged[Document]) error {
+func (u *UpdateBatchBuilder) addDocument(merged myiter.Merged[Document]) (doc *Document, atomic bool) {
 	// only new document
 	if merged.Left == nil || (merged.Left != nil && !u.canInPlaceUpdate(*merged.Left, *merged.Right)) {
-		encoded, err := JSONEncode(merged.Right, u.fields)
-		if err != nil {
-			return err
+		fields := make(Fields, 0, len(merged.Right.Fields)+1)
+		for _, field := range merged.Right.Fields {
+			if field.Key != VersionField && u.allowed(field.Key) && !u.removedIfEmpty(field) {
+				fields = append(fields, field)
+			}
 		}
-		builder.WriteString(encoded)
-		return nil
+		fields = u.appendVersion(fields, merged.Left)
+		return &Document{
+			ID:       merged.Right.ID,
+			Fields:   fields,
+			Children: merged.Right.Children,
+		}, false
 	}
 
 	// in-place update
 	doc1 := *merged.Left
 	doc2 := *merged.Right
-	mergedIter := myiter.NewMergedIterator(doc1.Fields.Iter(), doc2.Fields.Iter(), FieldCompare)
 
 	mergedFields := make(Fields, 0)
-	for field := range mergedIter.Iter() {
-		if (*field.Left).Value == (*field.Right).Value {
+	for field := range u.mergedFields(doc1, doc2) {
+		if field.Right == nil {
+			// removed field
+			if u.allowed(field.Left.Key) && u.canRemovePartially(field.Left.Key) {
+				mergedFields = append(mergedFields, Field{
+					Key:   field.Left.Key,
+					Value: Update{Op: OpSet, Value: nil},
+				})
+			}
 			continue
 		}
-		mergedFields = append(mergedFields, *field.Right)
+		if !u.canUpdatePartially(field.Right.Key) {
+			continue
+		}
+
+		var old interface{}
+		if field.Left != nil {
+			old = field.Left.Value
+			if u.valueEqual(field.Right.Key, old, field.Right.Value) {
+				if u.policy.Of(field.Right.Key) == PolicyAlwaysSend {
+					mergedFields = append(mergedFields, Field{Key: field.Right.Key, Value: Update{Op: OpSet, Value: field.Right.Value}})
+				}
+				continue
+			}
+		}
+		mergedFields = append(mergedFields, Field{
+			Key:   field.Right.Key,
+			Value: diffUpdates(u.operation(field.Right.Key), old, field.Right.Value, u.equalFunc(field.Right.Key)),
+		})
 	}
-	encoded, err := InPlaceUpdateEncode(&Document{
+	return &Document{
 		ID:     doc1.ID,
-		Fields: mergedFields,
-	}, u.inPlaceUpdateFields)
-	if err != nil {
-		return err
+		Fields: u.appendVersion(mergedFields, &doc1),
+	}, true
+}
+
+// appendVersion appends the _version_ of the old document for optimistic concurrency.
+func (u *UpdateBatchBuilder) appendVersion(fields Fields, old *Document) Fields {
+	if !u.optimistic || old == nil {
+		return fields
+	}
+	version, ok := old.Version()
+	if !ok {
+		return fields
+	}
+	return append(fields, Field{Key: VersionField, Value: version})
+}
+
+// mergedFields iterates the fields of old and new documents except _version_.
+// Empty fields of PolicyRemoveIfEmpty are treated as removed.
+func (u *UpdateBatchBuilder) mergedFields(old, new Document) iter.Seq[myiter.Merged[Field]] {
+	return func(yield func(myiter.Merged[Field]) bool) {
+		mi := myiter.NewMergedIterator(old.Fields.Iter(), new.Fields.Iter(), FieldCompare)
+		for field := range mi.Iter() {
+			if (field.Left != nil && field.Left.Key == VersionField) || (field.Right != nil && field.Right.Key == VersionField) {
+				continue
+			}
+			if field.Left != nil && u.removedIfEmpty(*field.Left) {
+				field.Left = nil
+			}
+			if field.Right != nil && u.removedIfEmpty(*field.Right) {
+				field.Right = nil
+			}
+			if field.Left == nil && field.Right == nil {
+				continue
+			}
+			if !yield(field) {
+				return
+			}
+		}
+	}
+}
+
+// removedIfEmpty reports whether the field is treated as removed by PolicyRemoveIfEmpty.
+func (u *UpdateBatchBuilder) removedIfEmpty(field Field) bool {
+	return u.policy.Of(field.Key) == PolicyRemoveIfEmpty && isEmptyValue(u.policy.normalize(field.Key, field.Value))
+}
+
+// valueEqual reports whether the values of the field are equal after the normalization.
+func (u *UpdateBatchBuilder) valueEqual(field string, v1, v2 interface{}) bool {
+	return ValueEqual(u.policy.normalize(field, v1), u.policy.normalize(field, v2))
+}
+
+// equalFunc returns valueEqual for the values of the field.
+func (u *UpdateBatchBuilder) equalFunc(field string) func(v1, v2 interface{}) bool {
+	return func(v1, v2 interface{}) bool {
+		return u.valueEqual(field, v1, v2)
 	}
-	builder.WriteString(encoded)
-	return nil
 }
 
+// childrenEqual reports whether the child documents are equal after the normalization of their fields.
+func (u *UpdateBatchBuilder) childrenEqual(c1, c2 []Document) bool {
+	return slices.EqualFunc(c1, c2, func(d1, d2 Document) bool {
+		return DocumentEqual(u.policy.normalizeDocument(d1), u.policy.normalizeDocument(d2))
+	})
+}
+
+// hasUpdates reports whether new is different from old in the fields that trigger updates.
 func (u *UpdateBatchBuilder) hasUpdates(old, new *Document) bool {
 	if old == nil || new == nil {
 		return true
 	}
-	mi := myiter.NewMergedIterator(old.Fields.Iter(), new.Fields.Iter(), FieldCompare)
-	for field := range mi.Iter() {
+	if !u.childrenEqual(old.Children, new.Children) {
+		return true
+	}
+	for field := range u.mergedFields(*old, *new) {
 		if field.Left != nil && field.Right != nil {
 			left := *field.Left
 			right := *field.Right
 
-			if left.Value != right.Value && contains(u.fields, left.Key) {
+			if !u.valueEqual(left.Key, left.Value, right.Value) && u.triggers(left.Key) {
 				return true
 			}
 		}
 		if field.Left == nil && field.Right != nil {
 			right := *field.Right
-			if contains(u.fields, right.Key) {
+			if u.triggers(right.Key) {
 				return true
 			}
 		}
 		if field.Left != nil && field.Right == nil {
 			left := *field.Left
-			if contains(u.fields, left.Key) {
+			if u.triggers(left.Key) {
 				return true
 			}
 		}
@@ -162,43 +451,95 @@ func (u *UpdateBatchBuilder) hasUpdates(old, new *Document) bool {
 	return false
 }
 
+// canInPlaceUpdate reports whether old can be updated to new partially.
+// A change of child documents requires reindexing the whole block, so it can not.
 func (u *UpdateBatchBuilder) canInPlaceUpdate(old, new Document) bool {
-	mi := myiter.NewMergedIterator(old.Fields.Iter(), new.Fields.Iter(), FieldCompare)
-	for field := range mi.Iter() {
+	if !u.childrenEqual(old.Children, new.Children) {
+		return false
+	}
+	for field := range u.mergedFields(old, new) {
 		left := field.Left
 		right := field.Right
 
 		if left != nil && right != nil {
-			if (*left).Value != (*right).Value {
-				if !contains(u.inPlaceUpdateFields, (*left).Key) {
+			if !u.valueEqual((*left).Key, (*left).Value, (*right).Value) {
+				if !u.canUpdatePartially((*left).Key) || hasChildDocuments((*right).Value) {
 					return false
 				}
 			}
 		}
 		if left == nil && right != nil {
-			if !contains(u.inPlaceUpdateFields, (*right).Key) {
+			if !u.canUpdatePartially((*right).Key) || hasChildDocuments((*right).Value) {
 				return false
 			}
 		}
 		// removed field
 		if left != nil && right == nil {
-			return false
+			if !u.canRemovePartially((*left).Key) || hasChildDocuments((*left).Value) {
+				return false
+			}
 		}
 	}
 	return true
 }
 
-func (u *UpdateBatchBuilder) encodeDelete(builder *queryBuilder) error {
+// deletes returns the documents to be deleted by id.
+// With SyncFull, they include the old documents that are not in the new documents,
+// and it returns an error if they are over the threshold.
+func (u *UpdateBatchBuilder) deletes() (DocSet, error) {
+	if u.syncMode != SyncFull {
+		return u.DeleteDocuments, nil
+	}
+
+	deletes := make(DocSet, len(u.DeleteDocuments))
+	for id, doc := range u.DeleteDocuments {
+		deletes[id] = doc
+	}
+	removed := 0
+	for id, doc := range u.OldDocuments {
+		if _, ok := u.Documents[id]; ok {
+			continue
+		}
+		deletes.Add(Document{ID: doc.ID})
+		removed++
+	}
+
+	if u.maxDeletePercent > 0 && removed > 0 {
+		percent := float64(removed) * 100 / float64(len(u.OldDocuments))
+		if percent > u.maxDeletePercent {
+			return nil, fmt.Errorf("%d of %d old documents (%.1f%%) would be deleted, over the threshold %.1f%%",
+				removed, len(u.OldDocuments), percent, u.maxDeletePercent)
+		}
+	}
+	return deletes, nil
+}
+
+func (u *UpdateBatchBuilder) encodeDelete(builder *queryBuilder, group Group, deletes DocSet) {
 	first := true
-	builder.WriteString("[")
-	for doc := range u.DeleteDocuments.Iter() {
+	builder.WriteString(group.Begin)
+	for doc := range deletes.Iter() {
 		if !first {
-			builder.WriteString(",")
+			builder.WriteString(group.Separator)
 		}
 		first = false
-		builder.WriteQuoteString(doc.ID, true)
+		builder.WriteString(u.encoder.EncodeDeleteID(doc.ID))
+	}
+	builder.WriteString(group.End)
+}
+
+func (u *UpdateBatchBuilder) encodeDeleteQueries(builder *queryBuilder, group Group) error {
+	builder.WriteString(group.Begin)
+	for i, query := range u.DeleteQueries {
+		if i > 0 {
+			builder.WriteString(group.Separator)
+		}
+		q, err := u.encoder.EncodeDeleteQuery(query)
+		if err != nil {
+			return err
+		}
+		builder.WriteString(q)
 	}
-	builder.WriteString("]")
+	builder.WriteString(group.End)
 	return nil
 }
 
@@ -206,35 +547,43 @@ func (u *UpdateBatchBuilder) Flush() {
 	u.OldDocuments = make(DocSet)
 	u.Documents = make(DocSet)
 	u.DeleteDocuments = make(DocSet)
+	u.DeleteQueries = nil
 }
 
+// queryBuilder writes a query to w.
+// Once an error occurs, subsequent writes are ignored and the error is returned by Error.
 type queryBuilder struct {
-	builder strings.Builder
-	err     error
+	w   io.Writer
+	err error
+}
+
+func newQueryBuilder(w io.Writer) *queryBuilder {
+	return &queryBuilder{w: w}
 }
 
 func (q *queryBuilder) WriteString(x string) {
 	if q.err != nil {
 		return
 	}
-	if _, err := q.builder.WriteString(x); err != nil {
+	if _, err := io.WriteString(q.w, x); err != nil {
 		q.err = err
 		return
 	}
 }
 
+// WriteQuoteString writes x. If quote is true, x is written as an escaped JSON string.
 func (q *queryBuilder) WriteQuoteString(x string, quote bool) {
 	if q.err != nil {
 		return
 	}
 
-	if quote {
-		q.WriteString("\"")
-	}
-	q.WriteString(x)
-	if quote {
-		q.WriteString("\"")
+	if !quote {
+		q.WriteString(x)
+		return
 	}
+	q.WriteString("\"")
+	q.WriteString(escapeJSONString(x))
+	q.WriteString("\"")
 }
 
 func (q *queryBuilder) WriteKVString(key string, value string, quote bool) {
@@ -247,13 +596,6 @@ func (q *queryBuilder) WriteKVString(key string, value string, quote bool) {
 	q.WriteQuoteString(value, quote)
 }
 
-func (q *queryBuilder) String() string {
-	if q.err != nil {
-		return ""
-	}
-	return q.builder.String()
-}
-
 func (q *queryBuilder) Error() error {
 	return q.err
 }
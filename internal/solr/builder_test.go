@@ -1,6 +1,9 @@
 package solr_test
 
 import (
+	"bytes"
+	"errors"
+	"math"
 	"testing"
 
 	"github.com/imishinist/solr-inplace-poc/internal/myiter"
@@ -98,6 +101,24 @@ func TestUpdateBatchBuilder_Build(t *testing.T) {
 				`,"delete":["11","12"]` +
 				`}`,
 		},
+		{
+			name: "escape ids",
+			add: []solr.Document{
+				{
+					ID: `"1"`,
+					Fields: []solr.Field{
+						{Key: "str1", Value: "a\tb"},
+					},
+				},
+			},
+			delete: []solr.Document{
+				{ID: `\2`},
+			},
+			expected: `{` +
+				`"add":{"doc":{"id":"\"1\"","str1":"a\tb"}}` +
+				`,"delete":["\\2"]` +
+				`}`,
+		},
 	}
 
 	for _, c := range cases {
@@ -131,6 +152,136 @@ func TestUpdateBatchBuilder_Build(t *testing.T) {
 	}
 }
 
+func TestUpdateBatchBuilder_BuildDeleteByQuery(t *testing.T) {
+	cases := []struct {
+		name string
+
+		add     []solr.Document
+		delete  []solr.Document
+		queries []solr.DeleteQuery
+
+		expected string
+	}{
+		{
+			name:     "only queries",
+			queries:  []solr.DeleteQuery{{Query: "type:old"}},
+			expected: `{"delete":{"query":"type:old"}}`,
+		},
+		{
+			name:     "insertion order",
+			queries:  []solr.DeleteQuery{{Query: "z:1"}, {Query: "a:1"}, {Query: "m:\"1\""}},
+			expected: `{"delete":{"query":"z:1"},"delete":{"query":"a:1"},"delete":{"query":"m:\"1\""}}`,
+		},
+		{
+			name:     "route and version",
+			queries:  []solr.DeleteQuery{{Query: "*:*", Route: "shard1!", Version: -1}},
+			expected: `{"delete":{"query":"*:*","_route_":"shard1!","_version_":-1}}`,
+		},
+		{
+			name:     "adds and deletes",
+			add:      []solr.Document{{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}}},
+			delete:   []solr.Document{{ID: "2"}},
+			queries:  []solr.DeleteQuery{{Query: "type:old"}},
+			expected: `{"add":{"doc":{"id":"1","str1":"a"}},"delete":["2"],"delete":{"query":"type:old"}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(nil, nil)
+			builder.Add(c.add...)
+			builder.Delete(c.delete...)
+			builder.DeleteByQuery(c.queries...)
+
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBatchBuilder_BuildSyncMode(t *testing.T) {
+	olds := []solr.Document{
+		{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}},
+		{ID: "2", Fields: []solr.Field{{Key: "str1", Value: "b"}}},
+		{ID: "3", Fields: []solr.Field{{Key: "str1", Value: "c"}}},
+		{ID: "4", Fields: []solr.Field{{Key: "str1", Value: "d"}}},
+	}
+	news := []solr.Document{
+		{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}},
+		{ID: "2", Fields: []solr.Field{{Key: "str1", Value: "B"}}},
+		{ID: "5", Fields: []solr.Field{{Key: "str1", Value: "e"}}},
+	}
+
+	cases := []struct {
+		name             string
+		mode             solr.SyncMode
+		maxDeletePercent float64
+		delete           []solr.Document
+
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "partial feed ignores old only documents",
+			mode:     solr.SyncPartial,
+			expected: `{"add":{"doc":{"id":"2","str1":"B"}},"add":{"doc":{"id":"5","str1":"e"}}}`,
+		},
+		{
+			name:     "full sync deletes old only documents",
+			mode:     solr.SyncFull,
+			delete:   []solr.Document{{ID: "9"}},
+			expected: `{"add":{"doc":{"id":"2","str1":"B"}},"add":{"doc":{"id":"5","str1":"e"}},"delete":["3","4","9"]}`,
+		},
+		{
+			name:             "full sync within threshold",
+			mode:             solr.SyncFull,
+			maxDeletePercent: 50,
+			expected:         `{"add":{"doc":{"id":"2","str1":"B"}},"add":{"doc":{"id":"5","str1":"e"}},"delete":["3","4"]}`,
+		},
+		{
+			name:             "full sync over threshold",
+			mode:             solr.SyncFull,
+			maxDeletePercent: 49.9,
+			wantErr:          true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(nil, nil)
+			builder.SetSyncMode(c.mode)
+			builder.SetMaxDeletePercent(c.maxDeletePercent)
+			builder.AddOld(olds...)
+			builder.Add(news...)
+			builder.Delete(c.delete...)
+
+			got, err := builder.Build()
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, but got %v", got)
+				}
+				for _, err := range builder.Batches(solr.BatchLimit{MaxDocs: 1}) {
+					if err == nil {
+						t.Fatal("expected error from Batches")
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
+
 func TestUpdateBatchBuilder_BuildInPlaceUpdate(t *testing.T) {
 	type Input myiter.Merged[solr.Document]
 	cases := []struct {
@@ -337,6 +488,54 @@ func TestUpdateBatchBuilder_BuildInPlaceUpdate(t *testing.T) {
 			inPlaceFields: []string{"int1"},
 			expected:      `{"add":{"doc":{"id":"1","int1":1}}}`,
 		},
+		{
+			name: "old and new documents/multi-valued field changed",
+			add: []Input{
+				{
+					Left: &solr.Document{
+						ID: "1",
+						Fields: []solr.Field{
+							{Key: "int1", Value: 1},
+							{Key: "tags", Value: []string{"a", "b"}},
+						},
+					},
+					Right: &solr.Document{
+						ID: "1",
+						Fields: []solr.Field{
+							{Key: "int1", Value: 1},
+							{Key: "tags", Value: []string{"b", "a"}}, // order changed
+						},
+					},
+				},
+			},
+			allowedFields: []string{"int1", "tags"},
+			inPlaceFields: []string{"tags"},
+			expected:      `{"add":{"doc":{"id":"1","tags":{"set":["b","a"]}}}}`,
+		},
+		{
+			name: "old and new documents/multi-valued field not changed",
+			add: []Input{
+				{
+					Left: &solr.Document{
+						ID: "1",
+						Fields: []solr.Field{
+							{Key: "int1", Value: 1},
+							{Key: "tags", Value: []string{"a", "b"}},
+						},
+					},
+					Right: &solr.Document{
+						ID: "1",
+						Fields: []solr.Field{
+							{Key: "int1", Value: 1},
+							{Key: "tags", Value: []interface{}{"a", "b"}},
+						},
+					},
+				},
+			},
+			allowedFields: []string{"int1", "tags"},
+			inPlaceFields: []string{"tags"},
+			expected:      `{}`,
+		},
 		{
 			name: "old and new documents/inplace fields removed",
 			add: []Input{
@@ -398,3 +597,765 @@ func TestUpdateBatchBuilder_BuildInPlaceUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateBatchBuilder_BuildAtomicOperations(t *testing.T) {
+	cases := []struct {
+		name string
+
+		old        *solr.Document
+		new        solr.Document
+		operations map[string]solr.Operation
+
+		expected string
+	}{
+		{
+			name: "inc/int",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 10},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 13},
+			}},
+			operations: map[string]solr.Operation{"count_i": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","count_i":{"inc":3}}}}`,
+		},
+		{
+			name: "inc/negative int",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: int32(10)},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: int64(-5)},
+			}},
+			operations: map[string]solr.Operation{"count_i": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","count_i":{"inc":-15}}}}`,
+		},
+		{
+			name: "inc/float",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "score_f", Value: 0.1},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "score_f", Value: 0.3},
+			}},
+			operations: map[string]solr.Operation{"score_f": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","score_f":{"set":0.3}}}}`,
+		},
+		{
+			name: "inc/float32",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "score_f", Value: float32(1.1)},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "score_f", Value: float32(2.2)},
+			}},
+			operations: map[string]solr.Operation{"score_f": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","score_f":{"set":2.2}}}}`,
+		},
+		{
+			name: "inc/overflow",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_l", Value: int64(math.MinInt64)},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_l", Value: int64(1)},
+			}},
+			operations: map[string]solr.Operation{"count_l": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","count_l":{"set":1}}}}`,
+		},
+		{
+			name: "inc/not numeric",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: "10"},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: "13"},
+			}},
+			operations: map[string]solr.Operation{"count_i": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","count_i":{"set":"13"}}}}`,
+		},
+		{
+			name: "inc/added field",
+			old:  &solr.Document{ID: "1", Fields: []solr.Field{}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 13},
+			}},
+			operations: map[string]solr.Operation{"count_i": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","count_i":{"set":13}}}}`,
+		},
+		{
+			name: "add/added and removed values",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "b", "c"}},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "c", "d", "e"}},
+			}},
+			operations: map[string]solr.Operation{"tags_s": solr.OpAdd},
+			expected:   `{"add":{"doc":{"id":"1","tags_s":{"remove":["b"],"add":["d","e"]}}}}`,
+		},
+		{
+			name: "remove/removed values",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "b", "c"}},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "c"}},
+			}},
+			operations: map[string]solr.Operation{"tags_s": solr.OpRemove},
+			expected:   `{"add":{"doc":{"id":"1","tags_s":{"remove":["b"]}}}}`,
+		},
+		{
+			name: "remove/added values are set",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "b"}},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "c"}},
+			}},
+			operations: map[string]solr.Operation{"tags_s": solr.OpRemove},
+			expected:   `{"add":{"doc":{"id":"1","tags_s":{"set":["a","c"]}}}}`,
+		},
+		{
+			name: "remove/duplicated values are set",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "a", "b"}},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "b"}},
+			}},
+			operations: map[string]solr.Operation{"tags_s": solr.OpRemove},
+			expected:   `{"add":{"doc":{"id":"1","tags_s":{"set":["a","b"]}}}}`,
+		},
+		{
+			name: "add-distinct/added values",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a"}},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "b"}},
+			}},
+			operations: map[string]solr.Operation{"tags_s": solr.OpAddDistinct},
+			expected:   `{"add":{"doc":{"id":"1","tags_s":{"add-distinct":["b"]}}}}`,
+		},
+		{
+			name: "add/removed duplicated value",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a", "a"}},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "tags_s", Value: []string{"a"}},
+			}},
+			operations: map[string]solr.Operation{"tags_s": solr.OpAdd},
+			expected:   `{"add":{"doc":{"id":"1","tags_s":{"set":["a"]}}}}`,
+		},
+		{
+			name: "mixed operations",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 1},
+				{Key: "tags_s", Value: []string{"a"}},
+				{Key: "title", Value: "title"},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 2},
+				{Key: "tags_s", Value: []string{}},
+				{Key: "title", Value: "changed"},
+			}},
+			operations: map[string]solr.Operation{
+				"count_i": solr.OpInc,
+				"tags_s":  solr.OpAdd,
+				"title":   solr.OpSet,
+			},
+			expected: `{"add":{"doc":{"id":"1","count_i":{"inc":1},"tags_s":{"remove":["a"]},"title":{"set":"changed"}}}}`,
+		},
+		{
+			name: "field without operation changed",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 1},
+				{Key: "title", Value: "title"},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "count_i", Value: 2},
+				{Key: "title", Value: "changed"},
+			}},
+			operations: map[string]solr.Operation{"count_i": solr.OpInc},
+			expected:   `{"add":{"doc":{"id":"1","count_i":2,"title":"changed"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(nil, nil)
+			for field, op := range c.operations {
+				if err := builder.SetOperation(field, op); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.old == nil {
+				builder.Add(c.new)
+			} else {
+				builder.Update(c.new, *c.old)
+			}
+
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBatchBuilder_SetOperation(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilder(nil, nil)
+	if err := builder.SetOperation("tags_s", solr.OpRemove); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.SetOperation("tags_s", solr.OpRemoveRegex); err == nil {
+		t.Fatal("expected error for removeregex")
+	}
+}
+
+func TestParseOperation(t *testing.T) {
+	for _, name := range []string{"set", "inc", "add", "add-distinct", "remove"} {
+		if _, err := solr.ParseOperation(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"removeregex", "unknown"} {
+		if _, err := solr.ParseOperation(name); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestUpdateBatchBuilder_BuildRemoveWithNull(t *testing.T) {
+	old := solr.Document{ID: "1", Fields: []solr.Field{
+		{Key: "int1", Value: 1},
+		{Key: "str1", Value: "string"},
+		{Key: "other", Value: "other"},
+	}}
+	cases := []struct {
+		name string
+
+		new            solr.Document
+		removeWithNull bool
+
+		expected string
+	}{
+		{
+			name: "disabled",
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "int1", Value: 2},
+				{Key: "other", Value: "other"},
+			}},
+			removeWithNull: false,
+			expected:       `{"add":{"doc":{"id":"1","int1":2}}}`,
+		},
+		{
+			name: "removed field",
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "int1", Value: 2},
+				{Key: "other", Value: "other"},
+			}},
+			removeWithNull: true,
+			expected:       `{"add":{"doc":{"id":"1","int1":{"set":2},"str1":{"set":null}}}}`,
+		},
+		{
+			name: "only removed field",
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "int1", Value: 1},
+				{Key: "other", Value: "other"},
+			}},
+			removeWithNull: true,
+			expected:       `{"add":{"doc":{"id":"1","str1":{"set":null}}}}`,
+		},
+		{
+			name: "removed in-place field",
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "str1", Value: "string"},
+				{Key: "other", Value: "other"},
+			}},
+			removeWithNull: true,
+			expected:       `{"add":{"doc":{"id":"1","str1":"string"}}}`,
+		},
+		{
+			name: "removed not allowed field",
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "int1", Value: 2},
+				{Key: "str1", Value: "string"},
+			}},
+			removeWithNull: true,
+			expected:       `{"add":{"doc":{"id":"1","int1":{"set":2}}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder([]string{"int1", "str1"}, []string{"int1"})
+			builder.SetRemoveWithNull(c.removeWithNull)
+			builder.Update(c.new, old)
+
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write error")
+}
+
+func TestUpdateBatchBuilder_BuildTo(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilder(nil, nil)
+	builder.Add(
+		solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "string1"}}},
+		solr.Document{ID: "2", Fields: []solr.Field{{Key: "str1", Value: "string2"}}},
+	)
+	builder.Delete(solr.Document{ID: "3"})
+
+	expected, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := builder.BuildTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != expected {
+		t.Fatalf("\nexpected:%v\n but got:%v", expected, got)
+	}
+
+	if err := builder.BuildTo(errWriter{}); err == nil {
+		t.Fatal("expected write error")
+	}
+}
+
+func TestUpdateBatchBuilder_BuildOptimisticConcurrency(t *testing.T) {
+	cases := []struct {
+		name string
+
+		old        *solr.Document
+		new        solr.Document
+		optimistic bool
+
+		expected string
+	}{
+		{
+			name: "disabled",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "_version_", Value: int64(100)},
+				{Key: "int1", Value: 1},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "int1", Value: 2},
+			}},
+			optimistic: false,
+			expected:   `{"add":{"doc":{"id":"1","int1":{"set":2}}}}`,
+		},
+		{
+			name: "in-place update",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "_version_", Value: int64(100)},
+				{Key: "int1", Value: 1},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "int1", Value: 2},
+			}},
+			optimistic: true,
+			expected:   `{"add":{"doc":{"id":"1","int1":{"set":2},"_version_":100}}}`,
+		},
+		{
+			name: "full update/version from csv",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "_version_", Value: "100"},
+				{Key: "str1", Value: "a"},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "_version_", Value: "200"},
+				{Key: "str1", Value: "b"},
+			}},
+			optimistic: true,
+			expected:   `{"add":{"doc":{"id":"1","str1":"b","_version_":100}}}`,
+		},
+		{
+			name: "only version changed",
+			old: &solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "_version_", Value: int64(100)},
+				{Key: "str1", Value: "a"},
+			}},
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "_version_", Value: int64(200)},
+				{Key: "str1", Value: "a"},
+			}},
+			optimistic: true,
+			expected:   `{}`,
+		},
+		{
+			name: "new document",
+			new: solr.Document{ID: "1", Fields: []solr.Field{
+				{Key: "str1", Value: "a"},
+			}},
+			optimistic: true,
+			expected:   `{"add":{"doc":{"id":"1","str1":"a"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(nil, []string{"int1"})
+			builder.SetOptimisticConcurrency(c.optimistic)
+			if c.old == nil {
+				builder.Add(c.new)
+			} else {
+				builder.Update(c.new, *c.old)
+			}
+
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBatchBuilder_BuildNested(t *testing.T) {
+	type Input myiter.Merged[solr.Document]
+	parent := func(title string, children ...solr.Document) *solr.Document {
+		return &solr.Document{
+			ID:       "1",
+			Fields:   []solr.Field{{Key: "int1", Value: 1}, {Key: "str1", Value: title}},
+			Children: children,
+		}
+	}
+	child := func(id, comment string) solr.Document {
+		return solr.Document{ID: id, Fields: []solr.Field{{Key: "comment_s", Value: comment}}}
+	}
+
+	cases := []struct {
+		name     string
+		add      []Input
+		expected string
+	}{
+		{
+			name: "unchanged children",
+			add: []Input{
+				{Left: parent("title", child("1-1", "a")), Right: parent("title", child("1-1", "a"))},
+			},
+			expected: "{}",
+		},
+		{
+			name: "children fetched with _version_",
+			add: []Input{
+				{
+					Left: parent("title", solr.Document{ID: "1-1", Fields: []solr.Field{
+						{Key: "comment_s", Value: "a"},
+						{Key: solr.VersionField, Value: int64(100)},
+					}}),
+					Right: parent("title", child("1-1", "a")),
+				},
+			},
+			expected: "{}",
+		},
+		{
+			name: "parent field changed",
+			add: []Input{
+				{Left: parent("title", child("1-1", "a")), Right: parent("new title", child("1-1", "a"))},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":{"set":"new title"}}}}`,
+		},
+		{
+			name: "child changed",
+			add: []Input{
+				{Left: parent("title", child("1-1", "a")), Right: parent("title", child("1-1", "b"))},
+			},
+			expected: `{"add":{"doc":{"id":"1","int1":1,"str1":"title","_childDocuments_":[{"id":"1-1","comment_s":"b"}]}}}`,
+		},
+		{
+			name: "child added",
+			add: []Input{
+				{Left: parent("title"), Right: parent("title", child("1-1", "a"))},
+			},
+			expected: `{"add":{"doc":{"id":"1","int1":1,"str1":"title","_childDocuments_":[{"id":"1-1","comment_s":"a"}]}}}`,
+		},
+		{
+			name: "labeled child changed",
+			add: []Input{
+				{
+					Left: &solr.Document{ID: "1", Fields: []solr.Field{
+						{Key: "str1", Value: "title"},
+						{Key: "comments", Value: []interface{}{child("1-1", "a")}},
+					}},
+					Right: &solr.Document{ID: "1", Fields: []solr.Field{
+						{Key: "str1", Value: "title"},
+						{Key: "comments", Value: []interface{}{child("1-1", "b")}},
+					}},
+				},
+			},
+			expected: `{"add":{"doc":{"id":"1","comments":[{"id":"1-1","comment_s":"b"}],"str1":"title"}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(nil, []string{"int1", "str1", "comments"})
+			for _, m := range c.add {
+				builder.Update(*m.Right, *m.Left)
+			}
+
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBatchBuilder_BuildPolicy(t *testing.T) {
+	type Input myiter.Merged[solr.Document]
+	cases := []struct {
+		name      string
+		policy    map[string]solr.FieldPolicy
+		normalize map[string][]solr.Normalizer
+		add       Input
+		expected  string
+	}{
+		{
+			name:   "ignore",
+			policy: map[string]solr.FieldPolicy{"str1": solr.PolicyIgnore},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "b"}}},
+			},
+			expected: "{}",
+		},
+		{
+			name:   "ignore/not sent in full add",
+			policy: map[string]solr.FieldPolicy{"str1": solr.PolicyIgnore},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}, {Key: "str2", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "b"}, {Key: "str2", Value: "b"}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str2":"b"}}}`,
+		},
+		{
+			name:   "atomic-set",
+			policy: map[string]solr.FieldPolicy{"str1": solr.PolicyAtomicSet},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}, {Key: "str2", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "b"}, {Key: "str2", Value: "a"}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":{"set":"b"}}}}`,
+		},
+		{
+			name:   "in-place/removed",
+			policy: map[string]solr.FieldPolicy{"int1": solr.PolicyInPlace},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "int1", Value: 1}, {Key: "str1", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":"a"}}}`,
+		},
+		{
+			name:   "increment",
+			policy: map[string]solr.FieldPolicy{"int1": solr.PolicyIncrement},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "int1", Value: 5}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "int1", Value: 3}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","int1":{"inc":-2}}}}`,
+		},
+		{
+			name:   "append-distinct",
+			policy: map[string]solr.FieldPolicy{"tags": solr.PolicyAppendDistinct},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "tags", Value: []string{"a", "b"}}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "tags", Value: []string{"b", "c"}}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","tags":{"remove":["a"],"add-distinct":["c"]}}}}`,
+		},
+		{
+			name:   "remove-if-empty",
+			policy: map[string]solr.FieldPolicy{"str1": solr.PolicyRemoveIfEmpty},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: ""}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":{"set":null}}}}`,
+		},
+		{
+			name:   "remove-if-empty/empty and missing are equal",
+			policy: map[string]solr.FieldPolicy{"str1": solr.PolicyRemoveIfEmpty},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: []string{}}}},
+			},
+			expected: "{}",
+		},
+		{
+			name:   "remove-if-empty/not sent in full add",
+			policy: map[string]solr.FieldPolicy{"str1": solr.PolicyRemoveIfEmpty},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str2", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: nil}, {Key: "str2", Value: "b"}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str2":"b"}}}`,
+		},
+		{
+			name:   "passive/only passive fields changed",
+			policy: map[string]solr.FieldPolicy{"updated_at": solr.PolicyPassive, "str1": solr.PolicyAtomicSet},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}, {Key: "updated_at", Value: "2024-01-01T00:00:00Z"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}, {Key: "updated_at", Value: "2024-01-02T00:00:00Z"}}},
+			},
+			expected: "{}",
+		},
+		{
+			name:   "passive/with other changes",
+			policy: map[string]solr.FieldPolicy{"updated_at": solr.PolicyPassive, "str1": solr.PolicyAtomicSet},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "a"}, {Key: "updated_at", Value: "2024-01-01T00:00:00Z"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "b"}, {Key: "updated_at", Value: "2024-01-02T00:00:00Z"}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":{"set":"b"},"updated_at":{"set":"2024-01-02T00:00:00Z"}}}}`,
+		},
+		{
+			name:   "always-send",
+			policy: map[string]solr.FieldPolicy{"source_s": solr.PolicyAlwaysSend, "str1": solr.PolicyAtomicSet},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "source_s", Value: "feed"}, {Key: "str1", Value: "a"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "source_s", Value: "feed"}, {Key: "str1", Value: "b"}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","source_s":{"set":"feed"},"str1":{"set":"b"}}}}`,
+		},
+		{
+			name:   "always-send/unchanged document",
+			policy: map[string]solr.FieldPolicy{"source_s": solr.PolicyAlwaysSend},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "source_s", Value: "feed"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "source_s", Value: "feed"}}},
+			},
+			expected: "{}",
+		},
+		{
+			name:      "normalized/unchanged",
+			policy:    map[string]solr.FieldPolicy{"str1": solr.PolicyAtomicSet},
+			normalize: map[string][]solr.Normalizer{"str1": {solr.NormalizeTrim, solr.NormalizeCaseFold}, "int1": {solr.NormalizeNumeric}},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "int1", Value: "10"}, {Key: "str1", Value: "Foo"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "int1", Value: 10.0}, {Key: "str1", Value: "foo "}}},
+			},
+			expected: "{}",
+		},
+		{
+			name:      "normalized/changed",
+			policy:    map[string]solr.FieldPolicy{"str1": solr.PolicyAtomicSet},
+			normalize: map[string][]solr.Normalizer{"str1": {solr.NormalizeTrim}},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "foo"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: " bar "}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":{"set":" bar "}}}}`,
+		},
+		{
+			name:      "normalized/remove-if-empty",
+			policy:    map[string]solr.FieldPolicy{"str1": solr.PolicyRemoveIfEmpty},
+			normalize: map[string][]solr.Normalizer{"str1": {solr.NormalizeTrim}},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "foo"}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "str1", Value: "  "}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","str1":{"set":null}}}}`,
+		},
+		{
+			name:      "normalized/append-distinct",
+			policy:    map[string]solr.FieldPolicy{"tags": solr.PolicyAppendDistinct},
+			normalize: map[string][]solr.Normalizer{"tags": {solr.NormalizeCaseFold}},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "tags", Value: []string{"A", "b"}}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "tags", Value: []string{"a", "B", "c"}}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","tags":{"add-distinct":["c"]}}}}`,
+		},
+		{
+			name:      "normalized/remove",
+			policy:    map[string]solr.FieldPolicy{"tags": solr.PolicyAppendDistinct},
+			normalize: map[string][]solr.Normalizer{"tags": {solr.NormalizeTrim}},
+			add: Input{
+				Left:  &solr.Document{ID: "1", Fields: []solr.Field{{Key: "tags", Value: []string{"a ", "b"}}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "tags", Value: []string{"a"}}}},
+			},
+			expected: `{"add":{"doc":{"id":"1","tags":{"remove":["b"]}}}}`,
+		},
+		{
+			name:      "normalized/child documents",
+			normalize: map[string][]solr.Normalizer{"comment": {solr.NormalizeTrim}, "count": {solr.NormalizeNumeric}},
+			add: Input{
+				Left: &solr.Document{ID: "1", Children: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "foo"}, {Key: "count", Value: int64(1)}}},
+				}},
+				Right: &solr.Document{ID: "1", Children: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "foo "}, {Key: "count", Value: "1"}}},
+				}},
+			},
+			expected: "{}",
+		},
+		{
+			name:      "normalized/labeled child documents",
+			normalize: map[string][]solr.Normalizer{"comment": {solr.NormalizeCaseFold}},
+			add: Input{
+				Left: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "comments", Value: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "Foo"}}},
+				}}}},
+				Right: &solr.Document{ID: "1", Fields: []solr.Field{{Key: "comments", Value: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "foo"}}},
+				}}}},
+			},
+			expected: "{}",
+		},
+		{
+			name:      "normalized/changed child documents",
+			normalize: map[string][]solr.Normalizer{"comment": {solr.NormalizeTrim}},
+			add: Input{
+				Left: &solr.Document{ID: "1", Children: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "foo"}}},
+				}},
+				Right: &solr.Document{ID: "1", Children: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "bar "}}},
+				}},
+			},
+			expected: `{"add":{"doc":{"id":"1","_childDocuments_":[{"id":"1-1","comment":"bar "}]}}}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilderWithPolicy(solr.Policy{Fields: c.policy, Normalize: c.normalize})
+			builder.Update(*c.add.Right, *c.add.Left)
+
+			got, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected:%v\n but got:%v", c.expected, got)
+			}
+		})
+	}
+}
@@ -2,11 +2,16 @@ package solr
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Client struct {
@@ -29,21 +34,131 @@ func (c *Client) url(component string, params url.Values) string {
 	return fmt.Sprintf("http://%s/%s?%s", c.host, u, params.Encode())
 }
 
-func (c *Client) Update(body string) (io.ReadCloser, error) {
+// CommitMode is how an update request is committed.
+type CommitMode int
+
+const (
+	// CommitNone does not commit, and relies on autoCommit, autoSoftCommit or commitWithin.
+	CommitNone CommitMode = iota
+	// CommitHard commits with commit=true.
+	CommitHard
+	// CommitSoft commits with softCommit=true.
+	CommitSoft
+)
+
+// ParseCommitMode parses "none", "hard" or "soft".
+func ParseCommitMode(s string) (CommitMode, error) {
+	switch s {
+	case "none":
+		return CommitNone, nil
+	case "hard":
+		return CommitHard, nil
+	case "soft":
+		return CommitSoft, nil
+	default:
+		return CommitNone, fmt.Errorf("unknown commit mode: %q", s)
+	}
+}
+
+// UpdateOptions is the options of an update request.
+type UpdateOptions struct {
+	Commit CommitMode
+	// CommitWithin commits the documents within the duration if it is positive.
+	CommitWithin time.Duration
+	// OpenSearcher sets openSearcher of a hard commit if it is not nil.
+	OpenSearcher *bool
+
+	// FailOnVersionConflicts makes version conflicts errors.
+	// If it is false, Solr silently drops the documents whose _version_ conflicts.
+	FailOnVersionConflicts bool
+	// UpdateChain is the update request processor chain (update.chain).
+	// Use a chain with TolerantUpdateProcessorFactory to get the version conflicts of each document.
+	UpdateChain string
+	// ContentType is the Content-Type of the body. It is "application/json" if empty.
+	// Use UpdateBatchBuilder.ContentType for bodies built by the builder.
+	ContentType string
+}
+
+func (o UpdateOptions) params() url.Values {
 	params := url.Values{}
-	params.Add("commit", "true")
-	params.Add("failOnVersionConflicts", "false")
+	switch o.Commit {
+	case CommitHard:
+		params.Add("commit", "true")
+		if o.OpenSearcher != nil {
+			params.Add("openSearcher", strconv.FormatBool(*o.OpenSearcher))
+		}
+	case CommitSoft:
+		params.Add("softCommit", "true")
+	}
+	if o.CommitWithin > 0 {
+		params.Add("commitWithin", strconv.FormatInt(o.CommitWithin.Milliseconds(), 10))
+	}
+	params.Add("failOnVersionConflicts", strconv.FormatBool(o.FailOnVersionConflicts))
+	if o.UpdateChain != "" {
+		params.Add("update.chain", o.UpdateChain)
+	}
+	return params
+}
+
+// Update sends the update request.
+// It returns *SolrError if Solr fails to process the request.
+func (c *Client) Update(body string, opts UpdateOptions) (*UpdateResponse, error) {
+	return c.UpdateFrom(strings.NewReader(body), opts)
+}
+
+// UpdateFrom sends the update request whose body is read from body.
+// body is streamed to Solr, so it can be the reader of io.Pipe written by UpdateBatchBuilder.BuildTo.
+func (c *Client) UpdateFrom(body io.Reader, opts UpdateOptions) (*UpdateResponse, error) {
+	params := opts.params()
+	params.Add("wt", "json")
 
 	url := c.url("update", params)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer([]byte(body)))
+	req, err := http.NewRequest(http.MethodPost, url, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = JSONEncoder{}.ContentType()
+	}
+	req.Header.Set("Content-Type", contentType)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	defer resp.Body.Close()
+
+	var ret UpdateResponse
+	if err := decodeResponse(resp, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Commit commits the pending updates.
+// It is used to commit once at the end of updates sent with CommitNone.
+func (c *Client) Commit(opts UpdateOptions) (*UpdateResponse, error) {
+	if opts.Commit == CommitNone {
+		return nil, errors.New("commit mode is none")
+	}
+	return c.Update("{}", UpdateOptions{Commit: opts.Commit, OpenSearcher: opts.OpenSearcher})
+}
+
+// Schema fetches the schema of the collection with the Schema API.
+func (c *Client) Schema() (*Schema, error) {
+	params := url.Values{}
+	params.Add("wt", "json")
+
+	resp, err := c.httpClient.Get(c.url("schema", params))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := decodeResponse(resp, &body); err != nil {
+		return nil, err
+	}
+	return LoadSchemaJSON(bytes.NewReader(body))
 }
@@ -0,0 +1,383 @@
+package solr_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *solr.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return solr.NewClient(strings.TrimPrefix(server.URL, "http://"), "test")
+}
+
+func TestClient_Update(t *testing.T) {
+	cases := []struct {
+		name       string
+		statusCode int
+		body       string
+
+		expected      *solr.UpdateResponse
+		expectedError *solr.SolrError
+	}{
+		{
+			name:       "success",
+			statusCode: http.StatusOK,
+			body:       `{"responseHeader":{"status":0,"QTime":5}}`,
+			expected: &solr.UpdateResponse{
+				ResponseHeader: solr.ResponseHeader{Status: 0, QTime: 5},
+			},
+		},
+		{
+			name:       "tolerant errors",
+			statusCode: http.StatusOK,
+			body: `{"responseHeader":{"errors":[` +
+				`{"type":"ADD","id":"1","message":"version conflict for 1 expected=10 actual=11"},` +
+				`{"type":"ADD","id":"2","message":"ERROR: [doc=2] unknown field 'foo'"}` +
+				`],"maxErrors":-1,"status":0,"QTime":3}}`,
+			expected: &solr.UpdateResponse{
+				ResponseHeader: solr.ResponseHeader{
+					Status: 0,
+					QTime:  3,
+					Errors: []solr.DocumentError{
+						{Type: "ADD", ID: "1", Message: "version conflict for 1 expected=10 actual=11"},
+						{Type: "ADD", ID: "2", Message: "ERROR: [doc=2] unknown field 'foo'"},
+					},
+				},
+			},
+		},
+		{
+			name:       "bad request",
+			statusCode: http.StatusBadRequest,
+			body: `{"responseHeader":{"status":400,"QTime":1},` +
+				`"error":{"metadata":["error-class","org.apache.solr.common.SolrException"],"msg":"ERROR: [doc=1] unknown field 'foo'","code":400}}`,
+			expectedError: &solr.SolrError{
+				StatusCode:     http.StatusBadRequest,
+				Code:           400,
+				Msg:            "ERROR: [doc=1] unknown field 'foo'",
+				Metadata:       []string{"error-class", "org.apache.solr.common.SolrException"},
+				ResponseHeader: solr.ResponseHeader{Status: 400, QTime: 1},
+			},
+		},
+		{
+			name:       "version conflict",
+			statusCode: http.StatusConflict,
+			body:       `{"responseHeader":{"status":409,"QTime":1},"error":{"msg":"version conflict for 1 expected=10 actual=11","code":409}}`,
+			expectedError: &solr.SolrError{
+				StatusCode:     http.StatusConflict,
+				Code:           409,
+				Msg:            "version conflict for 1 expected=10 actual=11",
+				ResponseHeader: solr.ResponseHeader{Status: 409, QTime: 1},
+			},
+		},
+		{
+			name:       "not json",
+			statusCode: http.StatusNotFound,
+			body:       "<html>Not Found</html>\n",
+			expectedError: &solr.SolrError{
+				StatusCode: http.StatusNotFound,
+				Code:       http.StatusNotFound,
+				Msg:        "<html>Not Found</html>",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/solr/test/update" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				w.WriteHeader(c.statusCode)
+				w.Write([]byte(c.body))
+			})
+
+			got, err := client.Update("{}", solr.UpdateOptions{})
+			if c.expectedError != nil {
+				var solrErr *solr.SolrError
+				if !errors.As(err, &solrErr) {
+					t.Fatalf("expected SolrError, but got %v", err)
+				}
+				if diff := cmp.Diff(c.expectedError, solrErr); diff != "" {
+					t.Fatalf("diff: %s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Fatalf("diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateResponse_VersionConflicts(t *testing.T) {
+	resp := &solr.UpdateResponse{
+		ResponseHeader: solr.ResponseHeader{
+			Errors: []solr.DocumentError{
+				{Type: "ADD", ID: "1", Message: "version conflict for 1 expected=10 actual=11"},
+				{Type: "ADD", ID: "2", Message: "ERROR: [doc=2] unknown field 'foo'"},
+			},
+		},
+	}
+
+	expected := []solr.DocumentError{
+		{Type: "ADD", ID: "1", Message: "version conflict for 1 expected=10 actual=11"},
+	}
+	if diff := cmp.Diff(expected, resp.VersionConflicts()); diff != "" {
+		t.Fatalf("diff: %s", diff)
+	}
+}
+
+func TestClient_UpdateOptions(t *testing.T) {
+	openSearcher := false
+	cases := []struct {
+		name     string
+		opts     solr.UpdateOptions
+		expected string
+	}{
+		{
+			name:     "no commit",
+			opts:     solr.UpdateOptions{Commit: solr.CommitNone},
+			expected: "failOnVersionConflicts=false&wt=json",
+		},
+		{
+			name:     "hard commit",
+			opts:     solr.UpdateOptions{Commit: solr.CommitHard},
+			expected: "commit=true&failOnVersionConflicts=false&wt=json",
+		},
+		{
+			name:     "hard commit without opening searcher",
+			opts:     solr.UpdateOptions{Commit: solr.CommitHard, OpenSearcher: &openSearcher},
+			expected: "commit=true&failOnVersionConflicts=false&openSearcher=false&wt=json",
+		},
+		{
+			name:     "soft commit",
+			opts:     solr.UpdateOptions{Commit: solr.CommitSoft},
+			expected: "failOnVersionConflicts=false&softCommit=true&wt=json",
+		},
+		{
+			name:     "commit within",
+			opts:     solr.UpdateOptions{CommitWithin: 5 * time.Second},
+			expected: "commitWithin=5000&failOnVersionConflicts=false&wt=json",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Encode(); got != c.expected {
+					t.Errorf("\nexpected: %s\n but got: %s", c.expected, got)
+				}
+				w.Write([]byte(`{"responseHeader":{"status":0,"QTime":1}}`))
+			})
+
+			if _, err := client.Update("{}", c.opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateContentType(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     solr.UpdateOptions
+		expected string
+	}{
+		{name: "default", opts: solr.UpdateOptions{}, expected: "application/json"},
+		{name: "xml", opts: solr.UpdateOptions{ContentType: solr.XMLEncoder{}.ContentType()}, expected: "application/xml"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Content-Type"); got != c.expected {
+					t.Errorf("expected %s, but got %s", c.expected, got)
+				}
+				w.Write([]byte(`{"responseHeader":{"status":0,"QTime":1}}`))
+			})
+
+			if _, err := client.Update("{}", c.opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/solr/test/get" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if diff := cmp.Diff([]string{"1", "2", "3"}, r.URL.Query()["id"]); diff != "" {
+			t.Errorf("unexpected ids: %s", diff)
+		}
+		if got := r.URL.Query().Get("fl"); got != "id,count_i,_version_" {
+			t.Errorf("unexpected fl: %s", got)
+		}
+		w.Write([]byte(`{"response":{"numFound":2,"start":0,"numFoundExact":true,"docs":[` +
+			`{"id":"1","count_i":10,"price_f":1.5,"tags_s":["a","b"],"_version_":1790000000000000000},` +
+			`{"id":"2","title":"title"}` +
+			`]}}`))
+	})
+
+	got, err := client.Get([]string{"1", "2", "3"}, []string{"id", "count_i", "_version_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []solr.Document{
+		{
+			ID: "1",
+			Fields: solr.Fields{
+				{Key: "_version_", Value: int64(1790000000000000000)},
+				{Key: "count_i", Value: int64(10)},
+				{Key: "price_f", Value: 1.5},
+				{Key: "tags_s", Value: []interface{}{"a", "b"}},
+			},
+		},
+		{
+			ID: "2",
+			Fields: solr.Fields{
+				{Key: "title", Value: "title"},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("diff: %s", diff)
+	}
+
+	version, ok := got[0].Version()
+	if !ok || version != 1790000000000000000 {
+		t.Fatalf("unexpected version: %v, %v", version, ok)
+	}
+}
+
+func TestClient_GetSingleID(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		expected []solr.Document
+	}{
+		{
+			name:     "found",
+			response: `{"doc":{"id":"1","count_i":10,"_version_":1790000000000000000}}`,
+			expected: []solr.Document{
+				{ID: "1", Fields: solr.Fields{
+					{Key: "_version_", Value: int64(1790000000000000000)},
+					{Key: "count_i", Value: int64(10)},
+				}},
+			},
+		},
+		{
+			name:     "not found",
+			response: `{"doc":null}`,
+			expected: []solr.Document{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if diff := cmp.Diff([]string{"1"}, r.URL.Query()["id"]); diff != "" {
+					t.Errorf("unexpected ids: %s", diff)
+				}
+				w.Write([]byte(c.response))
+			})
+
+			got, err := client.Get([]string{"1"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Fatalf("diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_Select(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/solr/test/select" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		expected := "fl=id%2Ccount_i&fq=type%3Aa&fq=count_i%3A%5B1+TO+%2A%5D&q=title%3Afoo&rows=2&sort=count_i+desc&start=4&wt=json"
+		if got := r.URL.Query().Encode(); got != expected {
+			t.Errorf("\nexpected: %s\n but got: %s", expected, got)
+		}
+		w.Write([]byte(`{"responseHeader":{"status":0,"QTime":1},"response":{"numFound":10,"start":4,"docs":[` +
+			`{"id":"5","count_i":5},` +
+			`{"id":"6","count_i":4}` +
+			`]}}`))
+	})
+
+	got, err := client.Select(solr.SelectParams{
+		Query:         "title:foo",
+		FilterQueries: []string{"type:a", "count_i:[1 TO *]"},
+		Fields:        []string{"id", "count_i"},
+		Sort:          "count_i desc",
+		Start:         4,
+		Rows:          2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &solr.SelectResponse{
+		NumFound: 10,
+		Start:    4,
+		Docs: []solr.Document{
+			{ID: "5", Fields: solr.Fields{{Key: "count_i", Value: int64(5)}}},
+			{ID: "6", Fields: solr.Fields{{Key: "count_i", Value: int64(4)}}},
+		},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("diff: %s", diff)
+	}
+}
+
+func TestClient_SelectAll(t *testing.T) {
+	pages := map[string]string{
+		"*":  `{"response":{"numFound":3,"start":0,"docs":[{"id":"1"},{"id":"2"}]},"nextCursorMark":"c1"}`,
+		"c1": `{"response":{"numFound":3,"start":0,"docs":[{"id":"3"}]},"nextCursorMark":"c2"}`,
+		"c2": `{"response":{"numFound":3,"start":0,"docs":[]},"nextCursorMark":"c2"}`,
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if got := query.Get("sort"); got != "title asc,id asc" {
+			t.Errorf("unexpected sort: %s", got)
+		}
+		if got := query.Get("rows"); got != "2" {
+			t.Errorf("unexpected rows: %s", got)
+		}
+		page, ok := pages[query.Get("cursorMark")]
+		if !ok {
+			t.Errorf("unexpected cursorMark: %s", query.Get("cursorMark"))
+		}
+		w.Write([]byte(page))
+	})
+
+	got := make([]string, 0)
+	for doc, err := range client.SelectAll(solr.SelectParams{Sort: "title asc", Rows: 2}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, doc.ID)
+	}
+	if diff := cmp.Diff([]string{"1", "2", "3"}, got); diff != "" {
+		t.Fatalf("diff: %s", diff)
+	}
+}
@@ -0,0 +1,60 @@
+package solr
+
+import (
+	"strings"
+	"time"
+)
+
+// DateLayout is the ISO-8601 UTC format of Solr dates.
+// Solr stores dates in milliseconds.
+const DateLayout = "2006-01-02T15:04:05.999Z"
+
+// DateMath is a date math expression such as "NOW/DAY" or "2024-01-01T00:00:00Z+1MONTH".
+// It is sent to Solr as it is, and evaluated by Solr.
+type DateMath string
+
+// FormatDate formats t in the ISO-8601 UTC format of Solr.
+func FormatDate(t time.Time) string {
+	return t.UTC().Format(DateLayout)
+}
+
+// ParseDate parses an ISO-8601 date of Solr such as "2024-01-02T03:04:05Z".
+func ParseDate(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// IsDateMath reports whether s is a date math expression.
+// An expression starts with NOW, or has a "||" between the anchor date and the math.
+func IsDateMath(s string) bool {
+	return strings.HasPrefix(s, "NOW") || strings.Contains(s, "||")
+}
+
+// dateEqual reports whether v1 and v2 are the same instant in milliseconds, the precision of Solr.
+// A string is compared as a date if the other value is time.Time.
+// ok is false if neither value is time.Time.
+func dateEqual(v1, v2 interface{}) (equal bool, ok bool) {
+	t1, ok1 := v1.(time.Time)
+	t2, ok2 := v2.(time.Time)
+	if !ok1 && !ok2 {
+		return false, false
+	}
+	if !ok1 {
+		t1, ok1 = asDate(v1)
+	}
+	if !ok2 {
+		t2, ok2 = asDate(v2)
+	}
+	return ok1 && ok2 && t1.Truncate(time.Millisecond).Equal(t2.Truncate(time.Millisecond)), true
+}
+
+func asDate(v interface{}) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := ParseDate(s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,162 @@
+package solr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DiffStatus is how a document is updated.
+type DiffStatus string
+
+const (
+	// DiffUnchanged is a document that is not updated.
+	DiffUnchanged DiffStatus = "unchanged"
+	// DiffInPlace is an atomic update whose fields are all in-place update fields.
+	DiffInPlace DiffStatus = "in-place"
+	// DiffAtomic is an atomic update.
+	DiffAtomic DiffStatus = "atomic"
+	// DiffAdd is a full add, a new document or a re-indexed document.
+	DiffAdd DiffStatus = "add"
+	// DiffDelete is a delete by id.
+	DiffDelete DiffStatus = "delete"
+)
+
+// DiffStatuses is all statuses in the order of the report.
+var DiffStatuses = []DiffStatus{DiffUnchanged, DiffInPlace, DiffAtomic, DiffAdd, DiffDelete}
+
+// FieldDiff is a change of a field.
+// Old is nil if the field is added, and New is nil if the field is removed.
+type FieldDiff struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// MarshalJSON encodes Old and New as JSONEncodeValue does, not as Go values.
+func (d FieldDiff) MarshalJSON() ([]byte, error) {
+	old, err := JSONEncodeValue(d.Old)
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %w", d.Field, err)
+	}
+	new, err := JSONEncodeValue(d.New)
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %w", d.Field, err)
+	}
+	return json.Marshal(struct {
+		Field string          `json:"field"`
+		Old   json.RawMessage `json:"old"`
+		New   json.RawMessage `json:"new"`
+	}{
+		Field: d.Field,
+		Old:   json.RawMessage(old),
+		New:   json.RawMessage(new),
+	})
+}
+
+// DocumentDiff is how a document is updated and its changed fields.
+type DocumentDiff struct {
+	ID     string      `json:"id"`
+	Status DiffStatus  `json:"status"`
+	Fields []FieldDiff `json:"fields,omitempty"`
+}
+
+// DiffReport is the report of the updates that Build would send.
+type DiffReport struct {
+	Documents []DocumentDiff     `json:"documents"`
+	Summary   map[DiffStatus]int `json:"summary"`
+	Queries   []DeleteQuery      `json:"deleteQueries,omitempty"`
+}
+
+// Diff reports the updates of the documents without building the request.
+// Documents are in the order of id, and deletes follow the updates as Build does.
+func (u *UpdateBatchBuilder) Diff() (*DiffReport, error) {
+	deletes, err := u.deletes()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{
+		Documents: make([]DocumentDiff, 0, len(u.Documents)+len(deletes)),
+		Summary:   make(map[DiffStatus]int, len(DiffStatuses)),
+		Queries:   u.DeleteQueries,
+	}
+	for _, status := range DiffStatuses {
+		report.Summary[status] = 0
+	}
+	add := func(diff DocumentDiff) {
+		report.Documents = append(report.Documents, diff)
+		report.Summary[diff.Status]++
+	}
+
+	mergedIter := NewMergedDocSetIterator(u.OldDocuments.Iter(), u.Documents.Iter())
+	for merged := range mergedIter.Iter() {
+		if merged.Right == nil {
+			continue
+		}
+		diff := DocumentDiff{ID: merged.Right.ID}
+		switch {
+		case !u.hasUpdates(merged.Left, merged.Right):
+			diff.Status = DiffUnchanged
+		case merged.Left == nil || !u.canInPlaceUpdate(*merged.Left, *merged.Right):
+			diff.Status = DiffAdd
+		default:
+			diff.Status = DiffAtomic
+		}
+		// an unchanged document is not sent, even if its passive fields are changed
+		if diff.Status != DiffUnchanged {
+			diff.Fields = u.fieldDiffs(merged.Left, merged.Right, diff.Status == DiffAtomic)
+		}
+		if diff.Status == DiffAtomic && u.inPlaceOnly(diff.Fields) {
+			diff.Status = DiffInPlace
+		}
+		add(diff)
+	}
+	for doc := range deletes.Iter() {
+		add(DocumentDiff{ID: doc.ID, Status: DiffDelete})
+	}
+	return report, nil
+}
+
+// fieldDiffs returns the changed fields that are not ignored.
+// All fields of a new document are changed.
+// If atomic, the unchanged always-send fields are returned as well, because the atomic update sets them.
+func (u *UpdateBatchBuilder) fieldDiffs(old, new *Document, atomic bool) []FieldDiff {
+	if old == nil {
+		old = &Document{ID: new.ID}
+	}
+
+	diffs := make([]FieldDiff, 0)
+	for field := range u.mergedFields(*old, *new) {
+		var diff FieldDiff
+		switch {
+		case field.Left == nil:
+			diff = FieldDiff{Field: field.Right.Key, New: field.Right.Value}
+		case field.Right == nil:
+			diff = FieldDiff{Field: field.Left.Key, Old: field.Left.Value}
+		case u.valueEqual(field.Left.Key, field.Left.Value, field.Right.Value):
+			if !atomic || !u.canUpdatePartially(field.Right.Key) || u.policy.Of(field.Right.Key) != PolicyAlwaysSend {
+				continue
+			}
+			diff = FieldDiff{Field: field.Left.Key, Old: field.Left.Value, New: field.Right.Value}
+		default:
+			diff = FieldDiff{Field: field.Left.Key, Old: field.Left.Value, New: field.Right.Value}
+		}
+		if u.allowed(diff.Field) {
+			diffs = append(diffs, diff)
+		}
+	}
+	if !u.childrenEqual(old.Children, new.Children) {
+		diffs = append(diffs, FieldDiff{Field: ChildDocumentsField, Old: old.Children, New: new.Children})
+	}
+	return diffs
+}
+
+// inPlaceOnly reports whether all changed fields are in-place update fields.
+func (u *UpdateBatchBuilder) inPlaceOnly(diffs []FieldDiff) bool {
+	for _, diff := range diffs {
+		if u.policy.Of(diff.Field) != PolicyInPlace {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package solr_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestUpdateBatchBuilder_Diff(t *testing.T) {
+	doc := func(id string, fields ...solr.Field) solr.Document {
+		return solr.Document{ID: id, Fields: fields}
+	}
+
+	builder := solr.NewUpdateBatchBuilderWithPolicy(solr.Policy{
+		Fields: map[string]solr.FieldPolicy{
+			"count_i":    solr.PolicyInPlace,
+			"title":      solr.PolicyAtomicSet,
+			"updated_at": solr.PolicyPassive,
+			"ignored_s":  solr.PolicyIgnore,
+		},
+	})
+	builder.SetSyncMode(solr.SyncFull)
+	builder.AddOld(
+		doc("1", solr.Field{Key: "count_i", Value: 1}, solr.Field{Key: "title", Value: "a"}),
+		doc("2", solr.Field{Key: "count_i", Value: 1}, solr.Field{Key: "title", Value: "a"}),
+		doc("3", solr.Field{Key: "count_i", Value: 1}, solr.Field{Key: "body", Value: "a"}),
+		doc("4", solr.Field{Key: "title", Value: "a"}, solr.Field{Key: "updated_at", Value: "2024"}, solr.Field{Key: "ignored_s", Value: "a"}),
+		doc("5"),
+	)
+	builder.Add(
+		doc("1", solr.Field{Key: "count_i", Value: 2}, solr.Field{Key: "title", Value: "a"}),
+		doc("2", solr.Field{Key: "count_i", Value: 1}, solr.Field{Key: "title", Value: "b"}),
+		doc("3", solr.Field{Key: "count_i", Value: 1}, solr.Field{Key: "body", Value: "b"}),
+		doc("4", solr.Field{Key: "title", Value: "a"}, solr.Field{Key: "updated_at", Value: "2025"}, solr.Field{Key: "ignored_s", Value: "b"}),
+		doc("6", solr.Field{Key: "title", Value: "new"}),
+	)
+	builder.DeleteByQuery(solr.DeleteQuery{Query: "type:old"})
+
+	got, err := builder.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &solr.DiffReport{
+		Documents: []solr.DocumentDiff{
+			{ID: "1", Status: solr.DiffInPlace, Fields: []solr.FieldDiff{{Field: "count_i", Old: 1, New: 2}}},
+			{ID: "2", Status: solr.DiffAtomic, Fields: []solr.FieldDiff{{Field: "title", Old: "a", New: "b"}}},
+			{ID: "3", Status: solr.DiffAdd, Fields: []solr.FieldDiff{{Field: "body", Old: "a", New: "b"}}},
+			{ID: "4", Status: solr.DiffUnchanged},
+			{ID: "6", Status: solr.DiffAdd, Fields: []solr.FieldDiff{{Field: "title", New: "new"}}},
+			{ID: "5", Status: solr.DiffDelete},
+		},
+		Summary: map[solr.DiffStatus]int{
+			solr.DiffUnchanged: 1,
+			solr.DiffInPlace:   1,
+			solr.DiffAtomic:    1,
+			solr.DiffAdd:       2,
+			solr.DiffDelete:    1,
+		},
+		Queries: []solr.DeleteQuery{{Query: "type:old"}},
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("(-expected, +got)\n%s", diff)
+	}
+}
+
+func TestUpdateBatchBuilder_DiffMaxDeletePercent(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilder(nil, nil)
+	builder.SetSyncMode(solr.SyncFull)
+	builder.SetMaxDeletePercent(10)
+	builder.AddOld(solr.Document{ID: "1"}, solr.Document{ID: "2"})
+	builder.Add(solr.Document{ID: "1"})
+
+	if _, err := builder.Diff(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUpdateBatchBuilder_DiffAlwaysSend(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilderWithPolicy(solr.Policy{
+		Fields: map[string]solr.FieldPolicy{
+			"count_i":  solr.PolicyInPlace,
+			"source_s": solr.PolicyAlwaysSend,
+		},
+	})
+	builder.AddOld(
+		solr.Document{ID: "1", Fields: []solr.Field{{Key: "count_i", Value: 1}, {Key: "source_s", Value: "feed"}}},
+		solr.Document{ID: "2", Fields: []solr.Field{{Key: "count_i", Value: 1}, {Key: "source_s", Value: "feed"}}},
+	)
+	builder.Add(
+		solr.Document{ID: "1", Fields: []solr.Field{{Key: "count_i", Value: 2}, {Key: "source_s", Value: "feed"}}},
+		solr.Document{ID: "2", Fields: []solr.Field{{Key: "count_i", Value: 1}, {Key: "source_s", Value: "feed"}}},
+	)
+
+	got, err := builder.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the always-send field is set with the update, so it is not in-place
+	expected := []solr.DocumentDiff{
+		{ID: "1", Status: solr.DiffAtomic, Fields: []solr.FieldDiff{{Field: "count_i", Old: 1, New: 2}, {Field: "source_s", Old: "feed", New: "feed"}}},
+		{ID: "2", Status: solr.DiffUnchanged},
+	}
+	if diff := cmp.Diff(expected, got.Documents); diff != "" {
+		t.Fatalf("(-expected, +got)\n%s", diff)
+	}
+}
+
+func TestFieldDiff_MarshalJSON(t *testing.T) {
+	cases := []struct {
+		name     string
+		diff     solr.FieldDiff
+		expected string
+	}{
+		{
+			name:     "scalar",
+			diff:     solr.FieldDiff{Field: "title", Old: "a", New: "b"},
+			expected: `{"field":"title","old":"a","new":"b"}`,
+		},
+		{
+			name:     "added",
+			diff:     solr.FieldDiff{Field: "tags", New: []string{"a"}},
+			expected: `{"field":"tags","old":null,"new":["a"]}`,
+		},
+		{
+			name:     "date",
+			diff:     solr.FieldDiff{Field: "created_at", Old: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			expected: `{"field":"created_at","old":"2024-01-02T03:04:05Z","new":null}`,
+		},
+		{
+			name: "child documents",
+			diff: solr.FieldDiff{
+				Field: solr.ChildDocumentsField,
+				Old:   []solr.Document{{ID: "1-1", Fields: []solr.Field{{Key: "comment", Value: "a"}}}},
+				New:   []solr.Document{},
+			},
+			expected: `{"field":"_childDocuments_","old":[{"id":"1-1","comment":"a"}],"new":[]}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := json.Marshal(c.diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.expected {
+				t.Fatalf("\nexpected: %s\n but got: %s", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiffReport_MarshalJSONDeleteQueries(t *testing.T) {
+	report := solr.DiffReport{
+		Documents: []solr.DocumentDiff{},
+		Summary:   map[solr.DiffStatus]int{},
+		Queries:   []solr.DeleteQuery{{Query: "type:old", Route: "shard1!", Version: 123}},
+	}
+	got, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the parameters are named as in the delete command of Solr
+	expected := `{"documents":[],"summary":{},"deleteQueries":[{"query":"type:old","_route_":"shard1!","_version_":123}]}`
+	if string(got) != expected {
+		t.Fatalf("\nexpected: %s\n but got: %s", expected, got)
+	}
+}
@@ -3,12 +3,18 @@ package solr
 import (
 	"iter"
 	"maps"
+	"math"
+	"reflect"
 	"slices"
 	"sort"
+	"strconv"
 
 	"github.com/imishinist/solr-inplace-poc/internal/myiter"
 )
 
+// Field is a document field.
+// Value is a scalar value, or a slice of scalar values for multi-valued fields.
+// The order of multi-values is preserved.
 type Field struct {
 	Key   string
 	Value interface{}
@@ -39,9 +45,259 @@ func FieldCompare(f1 Field, f2 Field) int {
 	return 1
 }
 
+// ValueEqual reports whether two field values are equal.
+// Multi-valued fields are equal if they have the same values in the same order.
+// Dates (time.Time) are equal if they are the same instant, even if one of them is an ISO-8601 string.
+// Child documents are compared by DocumentEqual.
+func ValueEqual(v1, v2 interface{}) bool {
+	values1, ok1 := multiValues(v1)
+	values2, ok2 := multiValues(v2)
+	if ok1 != ok2 {
+		return false
+	}
+	if !ok1 {
+		if equal, ok := dateEqual(v1, v2); ok {
+			return equal
+		}
+		d1, ok1 := v1.(Document)
+		d2, ok2 := v2.(Document)
+		if ok1 || ok2 {
+			return ok1 && ok2 && DocumentEqual(d1, d2)
+		}
+		return v1 == v2
+	}
+
+	if len(values1) != len(values2) {
+		return false
+	}
+	for i := range values1 {
+		if !ValueEqual(values1[i], values2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionField is the field for optimistic concurrency.
+const VersionField = "_version_"
+
+// ChildDocumentsField is the field of anonymous child documents in the JSON format.
+const ChildDocumentsField = "_childDocuments_"
+
+// Document is a Solr document.
+// A field whose value is a Document or []Document is a labeled relation to child documents,
+// and Children are anonymous child documents (_childDocuments_).
+// A parent and its children are indexed as a block, so a change of the children reindexes the whole block.
 type Document struct {
-	ID     string
-	Fields Fields
+	ID       string
+	Fields   Fields
+	Children []Document
+}
+
+// DocumentEqual reports whether two documents have the same id, fields and children.
+// The order of fields does not matter, but the order of children does.
+// _version_ is not compared, because it is set by Solr.
+func DocumentEqual(d1, d2 Document) bool {
+	if d1.ID != d2.ID {
+		return false
+	}
+
+	fields1 := sortedFieldsWithoutVersion(d1.Fields)
+	fields2 := sortedFieldsWithoutVersion(d2.Fields)
+	if len(fields1) != len(fields2) {
+		return false
+	}
+	for i := range fields1 {
+		if fields1[i].Key != fields2[i].Key || !ValueEqual(fields1[i].Value, fields2[i].Value) {
+			return false
+		}
+	}
+	return childrenEqual(d1.Children, d2.Children)
+}
+
+func sortedFieldsWithoutVersion(fields Fields) []Field {
+	ret := make([]Field, 0, len(fields))
+	for _, field := range fields {
+		if field.Key != VersionField {
+			ret = append(ret, field)
+		}
+	}
+	slices.SortFunc(ret, FieldCompare)
+	return ret
+}
+
+func childrenEqual(c1, c2 []Document) bool {
+	return slices.EqualFunc(c1, c2, DocumentEqual)
+}
+
+// HasChildren reports whether the document has child documents, anonymous or labeled.
+func (d *Document) HasChildren() bool {
+	return len(d.Children) > 0 || slices.ContainsFunc(d.Fields, func(f Field) bool {
+		return hasChildDocuments(f.Value)
+	})
+}
+
+// hasChildDocuments reports whether the field value is a labeled relation to child documents.
+func hasChildDocuments(v interface{}) bool {
+	if _, ok := v.(Document); ok {
+		return true
+	}
+	values, ok := multiValues(v)
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if _, ok := value.(Document); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Version returns the _version_ of the document.
+// A string version (e.g. read from CSV) is parsed as an integer.
+func (d *Document) Version() (int64, bool) {
+	for _, field := range d.Fields {
+		if field.Key != VersionField {
+			continue
+		}
+		switch v := field.Value.(type) {
+		case int64:
+			return v, true
+		case int:
+			return int64(v), true
+		case string:
+			version, err := strconv.ParseInt(v, 10, 64)
+			return version, err == nil
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// ConformDocument converts the field values of old to the representation of the same fields of like,
+// so that a document fetched from Solr can be compared with a document read from another format.
+// e.g. Solr returns 10 for an int field, while the CSV cell of the field is "10".
+// Numbers and booleans are converted to strings or to the number type of like,
+// and a single value is wrapped in or unwrapped from a multi-value as like is.
+// Child documents are conformed to the child documents of like with the same id.
+// The values that can not be converted are left as they are.
+func ConformDocument(old, like Document) Document {
+	likeValues := make(map[string]interface{}, len(like.Fields))
+	for _, field := range like.Fields {
+		likeValues[field.Key] = field.Value
+	}
+
+	ret := Document{
+		ID:       old.ID,
+		Fields:   make(Fields, 0, len(old.Fields)),
+		Children: conformChildren(old.Children, like.Children),
+	}
+	for _, field := range old.Fields {
+		if likeValue, ok := likeValues[field.Key]; ok {
+			field.Value = conformValue(field.Value, likeValue)
+		}
+		ret.Fields = append(ret.Fields, field)
+	}
+	return ret
+}
+
+func conformChildren(olds, likes []Document) []Document {
+	if olds == nil {
+		return nil
+	}
+	ret := make([]Document, len(olds))
+	for i, old := range olds {
+		ret[i] = old
+		if j := slices.IndexFunc(likes, func(like Document) bool { return like.ID == old.ID }); j >= 0 {
+			ret[i] = ConformDocument(old, likes[j])
+		}
+	}
+	return ret
+}
+
+func conformValue(v, like interface{}) interface{} {
+	likeValues, likeMulti := multiValues(like)
+	values, multi := multiValues(v)
+	if !likeMulti {
+		if multi && len(values) == 1 {
+			return conformScalar(values[0], like)
+		}
+		return conformScalar(v, like)
+	}
+
+	if !multi {
+		values = []interface{}{v}
+	}
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = value
+		for _, likeValue := range likeValues {
+			// children are conformed to the one with the same id, and the other values to any of like
+			if d, ok := likeValue.(Document); ok {
+				if old, ok := value.(Document); !ok || old.ID != d.ID {
+					continue
+				}
+			}
+			ret[i] = conformScalar(value, likeValue)
+			break
+		}
+	}
+	return ret
+}
+
+func conformScalar(v, like interface{}) interface{} {
+	switch like := like.(type) {
+	case Document:
+		if d, ok := v.(Document); ok && d.ID == like.ID {
+			return ConformDocument(d, like)
+		}
+		return v
+	case string:
+		switch v := v.(type) {
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+		return v
+	}
+
+	var f float64
+	switch n := v.(type) {
+	case int64:
+		f = float64(n)
+	case float64:
+		f = n
+	default:
+		return v
+	}
+	t := reflect.TypeOf(like)
+	if t == nil {
+		return v
+	}
+	rv := reflect.New(t).Elem()
+	switch {
+	case isInt(rv):
+		i, ok := v.(int64)
+		if !ok {
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return v
+			}
+			i = int64(f)
+		}
+		if rv.OverflowInt(i) {
+			return v
+		}
+		rv.SetInt(i)
+	case isNumber(rv):
+		rv.SetFloat(f)
+	default:
+		return v
+	}
+	return rv.Interface()
 }
 
 type DocSet map[string]Document
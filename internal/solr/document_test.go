@@ -3,6 +3,7 @@ package solr_test
 import (
 	"iter"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -166,3 +167,264 @@ func TestMergedDocSetIterator(t *testing.T) {
 		})
 	}
 }
+
+func TestValueEqual(t *testing.T) {
+	cases := []struct {
+		name     string
+		v1       interface{}
+		v2       interface{}
+		expected bool
+	}{
+		{name: "same scalar", v1: 1, v2: 1, expected: true},
+		{name: "different scalar", v1: 1, v2: 2, expected: false},
+		{name: "different type", v1: 1, v2: "1", expected: false},
+		{name: "scalar and multi-value", v1: "a", v2: []string{"a"}, expected: false},
+		{name: "same multi-values", v1: []string{"a", "b"}, v2: []string{"a", "b"}, expected: true},
+		{name: "same multi-values/different slice type", v1: []string{"a", "b"}, v2: []interface{}{"a", "b"}, expected: true},
+		{name: "different order", v1: []string{"a", "b"}, v2: []string{"b", "a"}, expected: false},
+		{name: "different length", v1: []string{"a"}, v2: []string{"a", "b"}, expected: false},
+		{name: "empty multi-values", v1: []string{}, v2: []interface{}{}, expected: true},
+		{name: "same instant", v1: time.Date(2024, 1, 2, 12, 0, 0, 0, time.FixedZone("JST", 9*60*60)), v2: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), expected: true},
+		{name: "different instant", v1: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), v2: time.Date(2024, 1, 2, 3, 0, 1, 0, time.UTC), expected: false},
+		{name: "date and iso-8601 string", v1: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), v2: "2024-01-02T03:00:00Z", expected: true},
+		{name: "date and iso-8601 string with offset", v1: "2024-01-02T12:00:00+09:00", v2: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), expected: true},
+		{name: "sub-millisecond difference", v1: time.Date(2024, 1, 2, 3, 0, 0, 123456789, time.UTC), v2: "2024-01-02T03:00:00.123Z", expected: true},
+		{name: "millisecond difference", v1: time.Date(2024, 1, 2, 3, 0, 0, 123456789, time.UTC), v2: "2024-01-02T03:00:00.124Z", expected: false},
+		{name: "date and non-date string", v1: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), v2: "foo", expected: false},
+		{name: "date strings", v1: "2024-01-02T12:00:00+09:00", v2: "2024-01-02T03:00:00Z", expected: false},
+		{name: "same date math", v1: solr.DateMath("NOW/DAY"), v2: solr.DateMath("NOW/DAY"), expected: true},
+		{name: "date math and string", v1: solr.DateMath("NOW/DAY"), v2: "NOW/DAY", expected: false},
+		{name: "same child documents", v1: solr.Document{ID: "1", Fields: solr.Fields{{Key: "a", Value: 1}, {Key: "b", Value: 2}}}, v2: solr.Document{ID: "1", Fields: solr.Fields{{Key: "b", Value: 2}, {Key: "a", Value: 1}}}, expected: true},
+		{name: "different child documents", v1: solr.Document{ID: "1", Fields: solr.Fields{{Key: "a", Value: 1}}}, v2: solr.Document{ID: "1", Fields: solr.Fields{{Key: "a", Value: 2}}}, expected: false},
+		{name: "child documents with _version_", v1: solr.Document{ID: "1", Fields: solr.Fields{{Key: "a", Value: 1}, {Key: solr.VersionField, Value: int64(100)}}}, v2: solr.Document{ID: "1", Fields: solr.Fields{{Key: "a", Value: 1}}}, expected: true},
+		{name: "different grandchildren", v1: solr.Document{ID: "1", Children: []solr.Document{{ID: "2"}}}, v2: solr.Document{ID: "1", Children: []solr.Document{{ID: "3"}}}, expected: false},
+		{name: "dates in multi-values", v1: []interface{}{time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)}, v2: []interface{}{"2024-01-02T03:00:00Z"}, expected: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := solr.ValueEqual(c.v1, c.v2); got != c.expected {
+				t.Fatalf("expected %v, but got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestConformDocument(t *testing.T) {
+	cases := []struct {
+		name     string
+		old      solr.Document
+		like     solr.Document
+		expected solr.Document
+	}{
+		{
+			name: "numbers and booleans to strings",
+			old: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: int64(10)},
+				{Key: "price", Value: 1.5},
+				{Key: "flag", Value: true},
+			}},
+			like: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: "20"},
+				{Key: "price", Value: "1.5"},
+				{Key: "flag", Value: "false"},
+			}},
+			expected: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: "10"},
+				{Key: "price", Value: "1.5"},
+				{Key: "flag", Value: "true"},
+			}},
+		},
+		{
+			name: "number types",
+			old: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: int64(10)},
+				{Key: "ratio", Value: 1.1},
+				{Key: "score", Value: int64(2)},
+				{Key: "total", Value: 3.0},
+				{Key: "half", Value: 0.5},
+				{Key: "large", Value: int64(3000000000)},
+			}},
+			like: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: int32(1)},
+				{Key: "ratio", Value: float32(1)},
+				{Key: "score", Value: 1.0},
+				{Key: "total", Value: int64(1)},
+				{Key: "half", Value: int64(1)},
+				{Key: "large", Value: int32(1)},
+			}},
+			expected: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: int32(10)},
+				{Key: "ratio", Value: float32(1.1)},
+				{Key: "score", Value: 2.0},
+				{Key: "total", Value: int64(3)},
+				{Key: "half", Value: 0.5},
+				{Key: "large", Value: int64(3000000000)},
+			}},
+		},
+		{
+			name: "single and multi-values",
+			old: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "tags", Value: "a"},
+				{Key: "nums", Value: []interface{}{int64(1), int64(2)}},
+				{Key: "title", Value: []interface{}{"foo"}},
+			}},
+			like: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "tags", Value: []interface{}{}},
+				{Key: "nums", Value: []interface{}{"3"}},
+				{Key: "title", Value: "bar"},
+			}},
+			expected: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "tags", Value: []interface{}{"a"}},
+				{Key: "nums", Value: []interface{}{"1", "2"}},
+				{Key: "title", Value: "foo"},
+			}},
+		},
+		{
+			name: "fields missing from like",
+			old: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: int64(10)},
+				{Key: solr.VersionField, Value: int64(100)},
+			}},
+			like: solr.Document{ID: "1"},
+			expected: solr.Document{ID: "1", Fields: solr.Fields{
+				{Key: "count", Value: int64(10)},
+				{Key: solr.VersionField, Value: int64(100)},
+			}},
+		},
+		{
+			name: "child documents",
+			old: solr.Document{ID: "1",
+				Fields: solr.Fields{
+					{Key: "comments", Value: []interface{}{
+						solr.Document{ID: "1-c1", Fields: solr.Fields{{Key: "likes", Value: int64(1)}}},
+					}},
+				},
+				Children: []solr.Document{
+					{ID: "1-1", Fields: solr.Fields{{Key: "count", Value: int64(1)}}},
+					{ID: "1-2", Fields: solr.Fields{{Key: "count", Value: int64(2)}}},
+				},
+			},
+			like: solr.Document{ID: "1",
+				Fields: solr.Fields{
+					{Key: "comments", Value: []interface{}{
+						solr.Document{ID: "1-c1", Fields: solr.Fields{{Key: "likes", Value: "5"}}},
+					}},
+				},
+				Children: []solr.Document{
+					{ID: "1-2", Fields: solr.Fields{{Key: "count", Value: "2"}}},
+				},
+			},
+			expected: solr.Document{ID: "1",
+				Fields: solr.Fields{
+					{Key: "comments", Value: []interface{}{
+						solr.Document{ID: "1-c1", Fields: solr.Fields{{Key: "likes", Value: "1"}}},
+					}},
+				},
+				Children: []solr.Document{
+					{ID: "1-1", Fields: solr.Fields{{Key: "count", Value: int64(1)}}},
+					{ID: "1-2", Fields: solr.Fields{{Key: "count", Value: "2"}}},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := solr.ConformDocument(c.old, c.like)
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONDocument(t *testing.T) {
+	cases := []struct {
+		name     string
+		raw      string
+		expected solr.Document
+		wantErr  bool
+	}{
+		{
+			name: "native types",
+			raw:  `{"id":"1","str_s":"foo","count_i":10,"price_f":1.5,"flag_b":true,"empty":null}`,
+			expected: solr.Document{
+				ID: "1",
+				Fields: solr.Fields{
+					{Key: "count_i", Value: int64(10)},
+					{Key: "empty", Value: nil},
+					{Key: "flag_b", Value: true},
+					{Key: "price_f", Value: 1.5},
+					{Key: "str_s", Value: "foo"},
+				},
+			},
+		},
+		{
+			name: "multi-values",
+			raw:  `{"id":"1","tags_ss":["a","b"],"nums_is":[1,2]}`,
+			expected: solr.Document{
+				ID: "1",
+				Fields: solr.Fields{
+					{Key: "nums_is", Value: []interface{}{int64(1), int64(2)}},
+					{Key: "tags_ss", Value: []interface{}{"a", "b"}},
+				},
+			},
+		},
+		{
+			name: "numeric id",
+			raw:  `{"id":12}`,
+			expected: solr.Document{
+				ID:     "12",
+				Fields: solr.Fields{},
+			},
+		},
+		{
+			name:    "no id",
+			raw:     `{"str_s":"foo"}`,
+			wantErr: true,
+		},
+		{
+			name: "child documents",
+			raw:  `{"id":"1","author":{"id":"1-a"},"comments":[{"id":"1-c1","n_i":1}],"_childDocuments_":[{"id":"1-1","_childDocuments_":[{"id":"1-1-1"}]}]}`,
+			expected: solr.Document{
+				ID: "1",
+				Fields: solr.Fields{
+					{Key: "author", Value: solr.Document{ID: "1-a", Fields: solr.Fields{}}},
+					{Key: "comments", Value: []interface{}{solr.Document{ID: "1-c1", Fields: solr.Fields{{Key: "n_i", Value: int64(1)}}}}},
+				},
+				Children: []solr.Document{
+					{ID: "1-1", Fields: solr.Fields{}, Children: []solr.Document{{ID: "1-1-1", Fields: solr.Fields{}}}},
+				},
+			},
+		},
+		{
+			name:    "object value without id",
+			raw:     `{"id":"1","obj":{"a":1}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			raw:     `{"id":`,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := solr.DecodeJSONDocument([]byte(c.raw))
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, but got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package solr
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func contains(slice []string, str string) bool {
@@ -17,25 +23,80 @@ func contains(slice []string, str string) bool {
 // JSONEncode encodes document with json format.
 // allowedFields is a fields slice that allowed encoding
 func JSONEncode(doc *Document, allowedFields []string) (string, error) {
-	return encode(doc, allowedFields, func(builder *queryBuilder, key, value string, quote bool) {
-		// write: `"#{key}": #{value}`
-		builder.WriteKVString(key, value, quote)
-	})
+	return encode(doc, allowedFields, writeJSONField)
 }
 
+// JSONEncodeValue encodes a field value as a JSON value, the same as JSONEncode writes it.
+// e.g. child documents are encoded as JSON documents, and dates as ISO-8601 strings.
+func JSONEncodeValue(v interface{}) (string, error) {
+	var buf strings.Builder
+	builder := newQueryBuilder(&buf)
+	if err := writeValue(builder, v); err != nil {
+		return "", err
+	}
+	if err := builder.Error(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// InPlaceUpdateEncode encodes document as an atomic update.
+// A field whose value is Update or []Update is written as the operations, and other fields are written as "set".
 func InPlaceUpdateEncode(doc *Document, allowedFields []string) (string, error) {
-	return encode(doc, allowedFields, func(builder *queryBuilder, key, value string, quote bool) {
-		// write: `"#{key}":{"set":#{value}}`
-		builder.WriteQuoteString(key, true)
-		builder.WriteString(`:{`)
-		builder.WriteKVString("set", value, quote)
-		builder.WriteString(`}`)
-	})
+	return encode(doc, allowedFields, writeUpdateField)
+}
+
+type fieldWriter func(builder *queryBuilder, key string, value interface{}) error
+
+func writeJSONField(builder *queryBuilder, key string, value interface{}) error {
+	// write: `"#{key}": #{value}`
+	builder.WriteQuoteString(key, true)
+	builder.WriteString(":")
+	return writeValue(builder, value)
+}
+
+// updatesOf returns the atomic update operations of a field value.
+// A value other than Update or []Update is "set".
+func updatesOf(value interface{}) []Update {
+	switch v := value.(type) {
+	case Update:
+		return []Update{v}
+	case []Update:
+		return v
+	default:
+		return []Update{{Op: OpSet, Value: v}}
+	}
 }
 
-func encode(doc *Document, allowedFields []string, yield func(builder *queryBuilder, key, value string, quote bool)) (string, error) {
-	var builder queryBuilder
+func writeUpdateField(builder *queryBuilder, key string, value interface{}) error {
+	updates := updatesOf(value)
 
+	// write: `"#{key}":{"#{op}":#{value},...}`
+	builder.WriteQuoteString(key, true)
+	builder.WriteString(`:{`)
+	for i, update := range updates {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteQuoteString(string(update.Op), true)
+		builder.WriteString(":")
+		if err := writeValue(builder, update.Value); err != nil {
+			return err
+		}
+	}
+	builder.WriteString(`}`)
+	return nil
+}
+
+func encode(doc *Document, allowedFields []string, yield fieldWriter) (string, error) {
+	var buf strings.Builder
+	if err := encodeTo(newQueryBuilder(&buf), doc, allowedFields, yield); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func encodeTo(builder *queryBuilder, doc *Document, allowedFields []string, yield fieldWriter) error {
 	builder.WriteString("{")
 
 	// write ID
@@ -46,32 +107,158 @@ func encode(doc *Document, allowedFields []string, yield func(builder *queryBuil
 		}
 
 		builder.WriteString(",")
+		// _version_ is not a field to be updated, but a condition of the update
+		if field.Key == VersionField {
+			if err := writeJSONField(builder, field.Key, field.Value); err != nil {
+				return fmt.Errorf("field %q: %w", field.Key, err)
+			}
+			continue
+		}
+		if err := yield(builder, field.Key, field.Value); err != nil {
+			return fmt.Errorf("field %q: %w", field.Key, err)
+		}
+	}
+	if len(doc.Children) > 0 {
+		builder.WriteString(",")
+		if err := writeJSONField(builder, ChildDocumentsField, doc.Children); err != nil {
+			return fmt.Errorf("child documents of %q: %w", doc.ID, err)
+		}
+	}
+	builder.WriteString("}")
+
+	return builder.Error()
+}
 
-		var value string
-		var quote bool
-		switch v := field.Value.(type) {
-		case int, int8, int16, int32, int64:
-			value = fmt.Sprintf("%d", v)
-			quote = false
-		case uint, uint8, uint16, uint32, uint64:
-			value = fmt.Sprintf("%ud", v)
-			quote = false
-		case float32, float64:
-			value = fmt.Sprintf("%g", v)
-			quote = false
-		case string:
-			value = v
-			quote = true
-		default:
-			return "", errors.New("unsupported field type")
+// writeValue writes a field value as a JSON value.
+// Multi-valued fields (slices) are written as JSON arrays, and pointers are written as the values they point to.
+// Child documents are written as JSON objects.
+func writeValue(builder *queryBuilder, v interface{}) error {
+	v = indirect(v)
+	if doc, ok := v.(Document); ok {
+		return encodeTo(builder, &doc, nil, writeJSONField)
+	}
+	if values, ok := multiValues(v); ok {
+		builder.WriteString("[")
+		for i, value := range values {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			if err := writeValue(builder, value); err != nil {
+				return err
+			}
 		}
-		yield(&builder, field.Key, value, quote)
+		builder.WriteString("]")
+		return nil
+	}
 
+	value, quote, err := formatScalar(v)
+	if err != nil {
+		return err
 	}
-	builder.WriteString("}")
+	builder.WriteQuoteString(value, quote)
+	return nil
+}
 
-	if err := builder.Error(); err != nil {
-		return "", err
+// indirect returns the value v points to. A nil pointer is nil.
+// *big.Int and *big.Float are values themselves.
+func indirect(v interface{}) interface{} {
+	for {
+		switch v.(type) {
+		case *big.Int, *big.Float:
+			return v
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Pointer {
+			return v
+		}
+		if rv.IsNil() {
+			return nil
+		}
+		v = rv.Elem().Interface()
+	}
+}
+
+// formatScalar formats a scalar value as a JSON value.
+// quote is true if the value is a string.
+// Named types are formatted as their underlying types.
+func formatScalar(v interface{}) (value string, quote bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", false, nil
+	case json.Number:
+		if !isJSONNumber(string(v)) {
+			return "", false, fmt.Errorf("invalid number: %q", string(v))
+		}
+		return string(v), false, nil
+	case *big.Int:
+		if v == nil {
+			return "null", false, nil
+		}
+		return v.String(), false, nil
+	case *big.Float:
+		if v == nil {
+			return "null", false, nil
+		}
+		if v.IsInf() {
+			return "", false, fmt.Errorf("unsupported float value: %v", v)
+		}
+		return v.Text('g', -1), false, nil
+	case time.Time:
+		return FormatDate(v), true, nil
+	case DateMath:
+		return string(v), true, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), false, nil
+	case reflect.Float32:
+		return formatFloat(rv.Float(), 32)
+	case reflect.Float64:
+		return formatFloat(rv.Float(), 64)
+	case reflect.String:
+		return rv.String(), true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported field type: %T", v)
+	}
+}
+
+// formatFloat formats f in the shortest representation that round-trips to the same float.
+// NaN and Inf are errors because JSON can not represent them.
+func formatFloat(f float64, bitSize int) (string, bool, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", false, fmt.Errorf("unsupported float value: %v", f)
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize), false, nil
+}
+
+// isJSONNumber reports whether s is a number in JSON.
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+// multiValues returns the values of a multi-valued field.
+// ok is false if v is not a slice.
+func multiValues(v interface{}) (values []interface{}, ok bool) {
+	if values, ok := v.([]interface{}); ok {
+		return values, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	values = make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
 	}
-	return builder.String(), nil
+	return values, true
 }
@@ -1,7 +1,11 @@
 package solr_test
 
 import (
+	"encoding/json"
+	"math"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/imishinist/solr-inplace-poc/internal/solr"
 )
@@ -46,6 +50,87 @@ func TestJSONEncode(t *testing.T) {
 			},
 			expected: `{"id":"1","int_1":10,"str_1":"foo","float_1":10.5}`,
 		},
+		{
+			name: "escape strings",
+			doc: solr.Document{
+				ID: `1"2`,
+				Fields: []solr.Field{
+					{Key: `str"1`, Value: `say "hello"`},
+					{Key: "str_2", Value: `C:\path\to`},
+					{Key: "str_3", Value: "line1\nline2\r\n\ttab"},
+					{Key: "str_4", Value: "\x00\x1f\b\f"},
+					{Key: "str_5", Value: "日本語 </script>"},
+				},
+			},
+			allowedFields: nil,
+			expected: `{"id":"1\"2",` +
+				`"str\"1":"say \"hello\"",` +
+				`"str_2":"C:\\path\\to",` +
+				`"str_3":"line1\nline2\r\n\ttab",` +
+				`"str_4":"\u0000\u001f\b\f",` +
+				`"str_5":"日本語 </script>"}`,
+		},
+		{
+			name: "invalid utf-8",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "str_1", Value: "a\xffb\xc3"},
+				},
+			},
+			allowedFields: nil,
+			expected:      `{"id":"1","str_1":"a` + "\ufffd" + `b` + "\ufffd" + `"}`,
+		},
+		{
+			name: "multi-valued fields",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "tags_s", Value: []string{"b", "a"}},
+					{Key: "nums_i", Value: []interface{}{1, 2}},
+					{Key: "empty_s", Value: []string{}},
+				},
+			},
+			allowedFields: nil,
+			expected:      `{"id":"1","tags_s":["b","a"],"nums_i":[1,2],"empty_s":[]}`,
+		},
+		{
+			name: "dates",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "created_at", Value: time.Date(2024, 1, 2, 12, 4, 5, 0, time.FixedZone("JST", 9*60*60))},
+					{Key: "updated_at", Value: time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)},
+					{Key: "expire_dt", Value: solr.DateMath("NOW/DAY+7DAYS")},
+					{Key: "days_dts", Value: []interface{}{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), solr.DateMath("NOW")}},
+				},
+			},
+			allowedFields: nil,
+			expected: `{"id":"1","created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05.123Z",` +
+				`"expire_dt":"NOW/DAY+7DAYS","days_dts":["2024-01-01T00:00:00Z","NOW"]}`,
+		},
+		{
+			name: "child documents",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "title", Value: "parent"},
+					{Key: "author", Value: solr.Document{ID: "1-a", Fields: []solr.Field{{Key: "name_s", Value: "foo"}}}},
+					{Key: "comments", Value: []solr.Document{{ID: "1-c1"}, {ID: "1-c2"}}},
+				},
+				Children: []solr.Document{
+					{
+						ID:       "1-1",
+						Fields:   []solr.Field{{Key: "str_s", Value: "child"}},
+						Children: []solr.Document{{ID: "1-1-1"}},
+					},
+				},
+			},
+			allowedFields: nil,
+			expected: `{"id":"1","title":"parent","author":{"id":"1-a","name_s":"foo"},` +
+				`"comments":[{"id":"1-c1"},{"id":"1-c2"}],` +
+				`"_childDocuments_":[{"id":"1-1","str_s":"child","_childDocuments_":[{"id":"1-1-1"}]}]}`,
+		},
 	}
 
 	for _, c := range cases {
@@ -101,6 +186,43 @@ func TestInPlaceUpdateEncode(t *testing.T) {
 			},
 			expected: `{"id":"1","int_1":{"set":10},"str_1":{"set":"foo"},"float_1":{"set":10.5}}`,
 		},
+		{
+			name: "escape strings",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "str_1", Value: "a\"b\\c\n"},
+				},
+			},
+			allowedFields: nil,
+			expected:      `{"id":"1","str_1":{"set":"a\"b\\c\n"}}`,
+		},
+		{
+			name: "multi-valued fields",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "tags_s", Value: []string{"x", "y"}},
+				},
+			},
+			allowedFields: nil,
+			expected:      `{"id":"1","tags_s":{"set":["x","y"]}}`,
+		},
+		{
+			name: "atomic operations",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "count_i", Value: solr.Update{Op: solr.OpInc, Value: -1}},
+					{Key: "tags_s", Value: []solr.Update{
+						{Op: solr.OpRemoveRegex, Value: "^old-.*"},
+						{Op: solr.OpAddDistinct, Value: []string{"new"}},
+					}},
+				},
+			},
+			allowedFields: nil,
+			expected:      `{"id":"1","count_i":{"inc":-1},"tags_s":{"removeregex":"^old-.*","add-distinct":["new"]}}`,
+		},
 	}
 
 	for _, c := range cases {
@@ -115,3 +237,83 @@ func TestInPlaceUpdateEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONEncode_Values(t *testing.T) {
+	type myInt int
+	type myString string
+	var (
+		i        = 10
+		s        = "foo"
+		nilPtr   *int
+		bigInt   = new(big.Int).Lsh(big.NewInt(1), 100)
+		bigNeg   = big.NewInt(-12345678901234)
+		bigFlt   = big.NewFloat(1.5)
+		largeF   = 12345678901234567890.0
+		preciseF = math.Nextafter(0.3, 1)
+	)
+
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected string
+		wantErr  bool
+	}{
+		{name: "nil", value: nil, expected: `null`},
+		{name: "true", value: true, expected: `true`},
+		{name: "false", value: false, expected: `false`},
+		{name: "int", value: -10, expected: `-10`},
+		{name: "int8", value: int8(-128), expected: `-128`},
+		{name: "int64", value: int64(math.MaxInt64), expected: `9223372036854775807`},
+		{name: "uint", value: uint(10), expected: `10`},
+		{name: "uint8", value: uint8(255), expected: `255`},
+		{name: "uint64", value: uint64(math.MaxUint64), expected: `18446744073709551615`},
+		{name: "float32", value: float32(0.1), expected: `0.1`},
+		{name: "float64", value: 10.5, expected: `10.5`},
+		{name: "float64 integer", value: 10.0, expected: `10`},
+		{name: "float64 precise", value: preciseF, expected: `0.30000000000000004`},
+		{name: "float64 large", value: largeF, expected: `1.2345678901234567e+19`},
+		{name: "float64 small", value: 1e-7, expected: `1e-07`},
+		{name: "NaN", value: math.NaN(), wantErr: true},
+		{name: "+Inf", value: math.Inf(1), wantErr: true},
+		{name: "-Inf", value: float32(math.Inf(-1)), wantErr: true},
+		{name: "string", value: "foo", expected: `"foo"`},
+		{name: "json.Number integer", value: json.Number("12345678901234567890"), expected: `12345678901234567890`},
+		{name: "json.Number float", value: json.Number("-1.5e10"), expected: `-1.5e10`},
+		{name: "invalid json.Number", value: json.Number("NaN"), wantErr: true},
+		{name: "empty json.Number", value: json.Number(""), wantErr: true},
+		{name: "big.Int", value: bigInt, expected: `1267650600228229401496703205376`},
+		{name: "negative big.Int", value: bigNeg, expected: `-12345678901234`},
+		{name: "nil big.Int", value: (*big.Int)(nil), expected: `null`},
+		{name: "big.Float", value: bigFlt, expected: `1.5`},
+		{name: "infinite big.Float", value: new(big.Float).SetInf(false), wantErr: true},
+		{name: "pointer to int", value: &i, expected: `10`},
+		{name: "pointer to string", value: &s, expected: `"foo"`},
+		{name: "nil pointer", value: nilPtr, expected: `null`},
+		{name: "named int", value: myInt(3), expected: `3`},
+		{name: "named string", value: myString("bar"), expected: `"bar"`},
+		{name: "multi-values with pointers", value: []*int{&i, nilPtr}, expected: `[10,null]`},
+		{name: "multi-values with NaN", value: []float64{1, math.NaN()}, wantErr: true},
+		{name: "map", value: map[string]int{"a": 1}, wantErr: true},
+		{name: "struct", value: struct{}{}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			doc := solr.Document{ID: "1", Fields: []solr.Field{{Key: "f", Value: c.value}}}
+			got, err := solr.JSONEncode(&doc, nil)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, but got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := `{"id":"1","f":` + c.expected + `}`
+			if got != expected {
+				t.Fatalf("\nexpected: %v\n but got: %v", expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package solr
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Encoder encodes the commands of an update request.
+// UpdateBatchBuilder writes update requests through an Encoder.
+type Encoder interface {
+	// ContentType is the Content-Type of the update request.
+	ContentType() string
+	// Layout is how the commands are framed in an update request.
+	Layout() Layout
+	// EncodeAdd encodes the add command of doc.
+	// If atomic is true, the fields are written as atomic updates:
+	// a field whose value is Update or []Update is written as the operations, and other fields are written as "set".
+	// _version_ is always written as a plain field.
+	EncodeAdd(doc *Document, atomic bool) (string, error)
+	// EncodeDeleteID encodes an id of the delete command.
+	EncodeDeleteID(id string) string
+	// EncodeDeleteQuery encodes a query of the delete-by-query command.
+	// It returns an error if the format can not represent the query (e.g. _route_ and _version_).
+	EncodeDeleteQuery(query DeleteQuery) (string, error)
+}
+
+// Layout is the frame of an update request:
+//
+//	#{Begin}#{add}#{Separator}#{add}#{Separator}#{delete by id}#{Separator}#{delete by query}#{End}
+//
+// Deletes by id and deletes by query are written in groups after the adds.
+type Layout struct {
+	Begin     string
+	End       string
+	Separator string
+
+	DeleteByID    Group
+	DeleteByQuery Group
+}
+
+// Group is the frame of a group of commands:
+//
+//	#{Begin}#{item}#{Separator}#{item}#{End}
+//
+// If the group is empty, Empty is written instead of the group (without the separator).
+type Group struct {
+	Begin     string
+	End       string
+	Separator string
+	Empty     string
+}
+
+// JSONEncoder encodes update requests in the JSON format.
+type JSONEncoder struct{}
+
+func (JSONEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (JSONEncoder) Layout() Layout {
+	return Layout{
+		Begin:     "{",
+		End:       "}",
+		Separator: ",",
+		DeleteByID: Group{
+			Begin:     `"delete":[`,
+			End:       "]",
+			Separator: ",",
+		},
+		// each query is a delete command
+		DeleteByQuery: Group{
+			Separator: ",",
+		},
+	}
+}
+
+// EncodeAdd encodes `"add":{"doc":#{doc}}`.
+func (JSONEncoder) EncodeAdd(doc *Document, atomic bool) (string, error) {
+	yield := writeJSONField
+	if atomic {
+		yield = writeUpdateField
+	}
+
+	var buf strings.Builder
+	builder := newQueryBuilder(&buf)
+	builder.WriteString(`"add":{"doc":`)
+	if err := encodeTo(builder, doc, nil, yield); err != nil {
+		return "", err
+	}
+	builder.WriteString("}")
+	if err := builder.Error(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (JSONEncoder) EncodeDeleteID(id string) string {
+	return quoteJSONString(id)
+}
+
+// EncodeDeleteQuery encodes `"delete":{"query":#{query},"_route_":#{route},"_version_":#{version}}`.
+func (JSONEncoder) EncodeDeleteQuery(query DeleteQuery) (string, error) {
+	var buf strings.Builder
+	buf.WriteString(`"delete":{"query":`)
+	buf.WriteString(quoteJSONString(query.Query))
+	if query.Route != "" {
+		buf.WriteString(`,"_route_":`)
+		buf.WriteString(quoteJSONString(query.Route))
+	}
+	if query.Version != 0 {
+		buf.WriteString(`,"_version_":`)
+		buf.WriteString(strconv.FormatInt(query.Version, 10))
+	}
+	buf.WriteString("}")
+	return buf.String(), nil
+}
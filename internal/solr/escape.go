@@ -0,0 +1,79 @@
+package solr
+
+import (
+	"unicode/utf8"
+)
+
+const hex = "0123456789abcdef"
+
+// escapeJSONString escapes s so that it can be embedded between double quotes
+// in a JSON document (RFC 8259, section 7).
+//
+// '"', '\\' and control characters (U+0000 - U+001F) are escaped.
+// Invalid UTF-8 byte sequences are replaced with U+FFFD, as encoding/json does,
+// so that the generated update body is always valid UTF-8.
+func escapeJSONString(s string) string {
+	if !needsEscape(s) {
+		return s
+	}
+
+	buf := make([]byte, 0, len(s)+8)
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\':
+				buf = append(buf, '\\', b)
+			case b == '\n':
+				buf = append(buf, '\\', 'n')
+			case b == '\r':
+				buf = append(buf, '\\', 'r')
+			case b == '\t':
+				buf = append(buf, '\\', 't')
+			case b == '\b':
+				buf = append(buf, '\\', 'b')
+			case b == '\f':
+				buf = append(buf, '\\', 'f')
+			case b < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+			default:
+				buf = append(buf, b)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return string(buf)
+}
+
+// quoteJSONString returns s as a JSON string literal.
+func quoteJSONString(s string) string {
+	return `"` + escapeJSONString(s) + `"`
+}
+
+func needsEscape(s string) bool {
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b < 0x20 || b == '"' || b == '\\' {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return true
+		}
+		i += size
+	}
+	return false
+}
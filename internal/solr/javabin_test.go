@@ -0,0 +1,299 @@
+package solr_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/javabin"
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestUpdateBatchBuilder_BuildJavabin(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name string
+
+		old     []solr.Document
+		add     []solr.Document
+		delete  []solr.Document
+		queries []solr.DeleteQuery
+		limit   solr.BatchLimit
+		allowed []string
+		inplace []string
+
+		expected []javabin.NamedList
+	}{
+		{
+			name: "add and atomic update",
+			old: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "int_1", Value: 10}, {Key: "str_1", Value: "a"}, {Key: solr.VersionField, Value: int64(100)}}},
+			},
+			add: []solr.Document{
+				{ID: "1", Fields: []solr.Field{{Key: "int_1", Value: 11}, {Key: "str_1", Value: "a"}}},
+				{ID: "2", Fields: []solr.Field{{Key: "int_1", Value: 20}, {Key: "str_1", Value: "b"}, {Key: "date_dt", Value: date}, {Key: "tags_ss", Value: []string{"x", "y"}}}},
+			},
+			inplace: []string{"int_1"},
+			expected: []javabin.NamedList{
+				{
+					{Key: "params", Value: javabin.NamedList{}},
+					{Key: "docs", Value: javabin.Iterator{
+						&javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{
+							{Key: "id", Value: "1"},
+							{Key: "int_1", Value: javabin.Map{{Key: "set", Value: int64(11)}}},
+						}},
+						&javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{
+							{Key: "id", Value: "2"},
+							{Key: "int_1", Value: int64(20)},
+							{Key: "str_1", Value: "b"},
+							{Key: "date_dt", Value: date},
+							{Key: "tags_ss", Value: []interface{}{"x", "y"}},
+						}},
+					}},
+					{Key: "delById", Value: nil},
+					{Key: "delByQ", Value: nil},
+				},
+			},
+		},
+		{
+			name:    "batches with deletes",
+			add:     []solr.Document{{ID: "1", Fields: []solr.Field{{Key: "str_1", Value: "a"}}}},
+			delete:  []solr.Document{{ID: "2"}},
+			queries: []solr.DeleteQuery{{Query: "type:old"}, {Query: "*:*"}},
+			limit:   solr.BatchLimit{MaxDocs: 2},
+			expected: []javabin.NamedList{
+				{
+					{Key: "params", Value: javabin.NamedList{}},
+					{Key: "docs", Value: javabin.Iterator{
+						&javabin.InputDocument{Boost: 1, Fields: []javabin.Entry{{Key: "id", Value: "1"}, {Key: "str_1", Value: "a"}}},
+					}},
+					{Key: "delById", Value: javabin.Iterator{"2"}},
+					{Key: "delByQ", Value: nil},
+				},
+				{
+					{Key: "params", Value: javabin.NamedList{}},
+					{Key: "docs", Value: javabin.Iterator{}},
+					{Key: "delById", Value: nil},
+					{Key: "delByQ", Value: javabin.Iterator{"type:old", "*:*"}},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := solr.NewUpdateBatchBuilder(c.allowed, c.inplace)
+			builder.SetEncoder(solr.JavabinEncoder{})
+			builder.AddOld(c.old...)
+			builder.Add(c.add...)
+			builder.Delete(c.delete...)
+			builder.DeleteByQuery(c.queries...)
+
+			got := make([]interface{}, 0)
+			for body, err := range builder.Batches(c.limit) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.limit.MaxBytes > 0 && len(body) > c.limit.MaxBytes {
+					t.Errorf("body is larger than MaxBytes: %d", len(body))
+				}
+				v, err := javabin.Unmarshal([]byte(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, v)
+			}
+
+			expected := make([]interface{}, 0, len(c.expected))
+			for _, nl := range c.expected {
+				expected = append(expected, nl)
+			}
+			if diff := cmp.Diff(expected, got); diff != "" {
+				t.Fatalf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateBatchBuilder_BatchesJavabinMaxBytes(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilder(nil, nil)
+	builder.SetEncoder(solr.JavabinEncoder{})
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		builder.Add(solr.Document{ID: id, Fields: []solr.Field{{Key: "str_1", Value: "value"}}})
+		builder.Delete(solr.Document{ID: "d" + id})
+	}
+
+	var sum int
+	for body, err := range builder.Batches(solr.BatchLimit{MaxBytes: 80}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) > 80 {
+			t.Errorf("body is larger than MaxBytes: %d", len(body))
+		}
+		v, err := javabin.Unmarshal([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := v.(javabin.NamedList)
+		docs, _ := request.Get("docs")
+		ids, _ := request.Get("delById")
+		sum += len(docs.(javabin.Iterator))
+		if ids != nil {
+			sum += len(ids.(javabin.Iterator))
+		}
+	}
+	if sum != 10 {
+		t.Fatalf("expected 10 commands, but got %d", sum)
+	}
+}
+
+func TestJavabinEncoder_EncodeAddError(t *testing.T) {
+	doc := solr.Document{ID: "1", Fields: []solr.Field{
+		{Key: "str_1", Value: "value"},
+		{Key: "obj", Value: map[string]int{"a": 1}},
+	}}
+	_, err := solr.JavabinEncoder{}.EncodeAdd(&doc, false)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if expected := `field "obj": unsupported type: map[string]int`; err.Error() != expected {
+		t.Fatalf("expected %q, but got %q", expected, err.Error())
+	}
+}
+
+// solrjUpdateRequest is the javabin update request that JavaBinUpdateRequestCodec.marshal of SolrJ writes for:
+//
+//	SolrInputDocument doc1 = new SolrInputDocument();
+//	doc1.addField("id", "1");
+//	doc1.addField("count_l", 20L);
+//	doc1.addField("tags_ss", Arrays.asList("x", "y"));
+//	doc1.addField("title", "foo");
+//	SolrInputDocument doc2 = new SolrInputDocument();
+//	doc2.addField("id", "2");
+//	doc2.addField("count_l", Collections.singletonMap("set", 11L));
+//	UpdateRequest req = new UpdateRequest();
+//	req.add(doc1);
+//	req.add(doc2);
+//	req.deleteById("3");
+//	req.deleteByQuery("type:old");
+//
+// The extern strings are numbered from 1 in the order they are first written.
+var solrjUpdateRequest = slices.Concat([]byte{
+	2,                                        // version
+	0xc4,                                     // NAMED_LST of 4
+	0xe0, 0x26, 'p', 'a', 'r', 'a', 'm', 's', // "params" (extern 1)
+	0xa0,                                                         // ORDERED_MAP of 0
+	0xe0, 0x2a, 'd', 'e', 'l', 'B', 'y', 'I', 'd', 'M', 'a', 'p', // "delByIdMap" (extern 2)
+	10, 1, 0xe0, 0x21, '3', 0, // MAP {"3" (extern 3): null}
+	0xe0, 0x26, 'd', 'e', 'l', 'B', 'y', 'Q', // "delByQ" (extern 4)
+	0x81, 0x28, 't', 'y', 'p', 'e', ':', 'o', 'l', 'd', // ARR ["type:old"]
+	0xe0, 0x27, 'd', 'o', 'c', 's', 'M', 'a', 'p', // "docsMap" (extern 5)
+	14, // ITERATOR
+	19, // MAP_ENTRY
+}, solrjDocument, []byte{
+	0,                          // null parameters of the document
+	19,                         // MAP_ENTRY
+	16, 2, 8, 0x3f, 0x80, 0, 0, // SOLRINPUTDOC of 2 fields, boost 1.0
+	0xe6, 0x21, '2', // extern 6 ("id"): "2"
+	0xe7, 10, 1, 0xe0, 0x23, 's', 'e', 't', 0x6b, // extern 7 ("count_l"): MAP {"set" (extern 10): SLONG 11}
+	0,  // null parameters of the document
+	15, // END
+})
+
+// solrjDocument is doc1 of solrjUpdateRequest.
+var solrjDocument = []byte{
+	16, 4, 8, 0x3f, 0x80, 0, 0, // SOLRINPUTDOC of 4 fields, boost 1.0
+	0xe0, 0x22, 'i', 'd', 0x21, '1', // "id" (extern 6): "1"
+	0xe0, 0x27, 'c', 'o', 'u', 'n', 't', '_', 'l', 0x74, 0x01, // "count_l" (extern 7): SLONG 20
+	0xe0, 0x27, 't', 'a', 'g', 's', '_', 's', 's', 0x82, 0x21, 'x', 0x21, 'y', // "tags_ss" (extern 8): ["x", "y"]
+	0xe0, 0x25, 't', 'i', 't', 'l', 'e', 0x23, 'f', 'o', 'o', // "title" (extern 9): "foo"
+}
+
+// solrjCommands returns the documents, the ids and the queries of a javabin update request
+// in either layout of SolrJ ("docsMap", "delByIdMap" and an array of "delByQ") or JavabinEncoder.
+func solrjCommands(t *testing.T, request javabin.NamedList) (docs, ids, queries []interface{}) {
+	t.Helper()
+
+	for _, e := range request {
+		switch e.Key {
+		case "docs":
+			docs = append(docs, e.Value.(javabin.Iterator)...)
+		case "docsMap":
+			for _, entry := range e.Value.(javabin.Iterator) {
+				docs = append(docs, entry.(javabin.MapEntry).Key)
+			}
+		case "delById":
+			if e.Value != nil {
+				ids = append(ids, e.Value.(javabin.Iterator)...)
+			}
+		case "delByIdMap":
+			for _, entry := range e.Value.(javabin.Map) {
+				ids = append(ids, entry.Key)
+			}
+		case "delByQ":
+			switch v := e.Value.(type) {
+			case javabin.Iterator:
+				queries = append(queries, v...)
+			case []interface{}:
+				queries = append(queries, v...)
+			}
+		case "params":
+			if diff := cmp.Diff(javabin.NamedList{}, e.Value); diff != "" {
+				t.Errorf("params (-expected, +got)\n%s", diff)
+			}
+		default:
+			t.Errorf("unknown entry: %q", e.Key)
+		}
+	}
+	return docs, ids, queries
+}
+
+func TestJavabinEncoder_SolrJ(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilder(nil, []string{"count_l"})
+	builder.SetEncoder(solr.JavabinEncoder{})
+	builder.AddOld(
+		solr.Document{ID: "2", Fields: []solr.Field{{Key: "count_l", Value: int64(10)}}},
+		solr.Document{ID: "3"},
+	)
+	builder.Add(
+		solr.Document{ID: "1", Fields: []solr.Field{{Key: "count_l", Value: int64(20)}, {Key: "tags_ss", Value: []string{"x", "y"}}, {Key: "title", Value: "foo"}}},
+		solr.Document{ID: "2", Fields: []solr.Field{{Key: "count_l", Value: int64(11)}}},
+	)
+	builder.Delete(solr.Document{ID: "3"})
+	builder.DeleteByQuery(solr.DeleteQuery{Query: "type:old"})
+	body, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first document is written as SolrJ does, including the extern strings of the field names.
+	// The names of the second one are not references to them, but new extern strings.
+	if !bytes.Contains([]byte(body), solrjDocument) {
+		t.Errorf("the first document is not written as SolrJ does:\nexpected: %v\n but got: %v", solrjDocument, []byte(body))
+	}
+
+	expected, err := javabin.Unmarshal(solrjUpdateRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := javabin.Unmarshal([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDocs, expectedIDs, expectedQueries := solrjCommands(t, expected.(javabin.NamedList))
+	gotDocs, gotIDs, gotQueries := solrjCommands(t, got.(javabin.NamedList))
+	if diff := cmp.Diff(expectedDocs, gotDocs); diff != "" {
+		t.Errorf("docs (-expected, +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(expectedIDs, gotIDs); diff != "" {
+		t.Errorf("ids (-expected, +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(expectedQueries, gotQueries); diff != "" {
+		t.Errorf("queries (-expected, +got)\n%s", diff)
+	}
+}
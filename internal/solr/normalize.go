@@ -0,0 +1,126 @@
+package solr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer normalizes a field value before the builder compares it.
+// Normalized values are used only for the comparison, and the values sent to Solr are not changed.
+type Normalizer string
+
+const (
+	// NormalizeTrim removes leading and trailing white spaces of strings.
+	NormalizeTrim Normalizer = "trim"
+	// NormalizeNFC normalizes strings to Unicode NFC.
+	NormalizeNFC Normalizer = "nfc"
+	// NormalizeCaseFold folds the case of strings.
+	NormalizeCaseFold Normalizer = "case-fold"
+	// NormalizeNumeric converts numbers and numeric strings to int64 if they are integers, or float64.
+	// e.g. "10", 10 and 10.0 are the same.
+	NormalizeNumeric Normalizer = "numeric"
+	// NormalizeDate converts dates and date strings to UTC in milliseconds, the precision of Solr.
+	NormalizeDate Normalizer = "date"
+)
+
+// ParseNormalizer parses a normalizer name.
+func ParseNormalizer(s string) (Normalizer, error) {
+	switch n := Normalizer(s); n {
+	case NormalizeTrim, NormalizeNFC, NormalizeCaseFold, NormalizeNumeric, NormalizeDate:
+		return n, nil
+	default:
+		return "", fmt.Errorf("unknown normalizer: %q", s)
+	}
+}
+
+// Normalize returns the normalized value. Multi-values are normalized one by one.
+// Values that the normalizer does not apply to are returned as they are.
+func (n Normalizer) Normalize(v interface{}) interface{} {
+	v = indirect(v)
+	if values, ok := multiValues(v); ok {
+		ret := make([]interface{}, len(values))
+		for i, value := range values {
+			ret[i] = n.Normalize(value)
+		}
+		return ret
+	}
+
+	switch n {
+	case NormalizeTrim:
+		return mapString(v, strings.TrimSpace)
+	case NormalizeNFC:
+		return mapString(v, norm.NFC.String)
+	case NormalizeCaseFold:
+		return mapString(v, cases.Fold().String)
+	case NormalizeNumeric:
+		if f, ok := normalizeNumber(v); ok {
+			return f
+		}
+	case NormalizeDate:
+		if t, ok := v.(time.Time); ok {
+			return t.UTC().Truncate(time.Millisecond)
+		}
+		if t, ok := asDate(v); ok {
+			return t.UTC().Truncate(time.Millisecond)
+		}
+	}
+	return v
+}
+
+// mapString applies f to v if v is a string.
+func mapString(v interface{}, f func(string) string) interface{} {
+	if s, ok := v.(string); ok {
+		return f(s)
+	}
+	return v
+}
+
+// normalizeNumber returns the number of v as int64 if it is an integer, or float64.
+// ok is false if v is not a number or a numeric string.
+func normalizeNumber(v interface{}) (interface{}, bool) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = strings.TrimSpace(v)
+	case json.Number:
+		s = string(v)
+	default:
+		rv := reflect.ValueOf(v)
+		switch {
+		case isInt(rv):
+			return rv.Int(), true
+		case rv.CanUint():
+			if u := rv.Uint(); u <= math.MaxInt64 {
+				return int64(u), true
+			}
+			return float64(rv.Uint()), true
+		case isNumber(rv):
+			return canonicalFloat(rv.Float()), true
+		}
+		return nil, false
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return canonicalFloat(f), true
+	}
+	return nil, false
+}
+
+// canonicalFloat returns f as int64 if it is an integer in the range of int64.
+func canonicalFloat(f float64) interface{} {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+	return f
+}
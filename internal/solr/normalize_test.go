@@ -0,0 +1,54 @@
+package solr_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestNormalizer_Normalize(t *testing.T) {
+	cases := []struct {
+		name       string
+		normalizer solr.Normalizer
+		value      interface{}
+		expected   interface{}
+	}{
+		{name: "trim", normalizer: solr.NormalizeTrim, value: " foo \t\n", expected: "foo"},
+		{name: "trim/multi-values", normalizer: solr.NormalizeTrim, value: []string{" a", "b "}, expected: []interface{}{"a", "b"}},
+		{name: "trim/not string", normalizer: solr.NormalizeTrim, value: 10, expected: 10},
+		{name: "nfc", normalizer: solr.NormalizeNFC, value: "e\u0301", expected: "\u00e9"},
+		{name: "case-fold", normalizer: solr.NormalizeCaseFold, value: "Straße", expected: "strasse"},
+		{name: "numeric/int string", normalizer: solr.NormalizeNumeric, value: "10", expected: int64(10)},
+		{name: "numeric/integral float", normalizer: solr.NormalizeNumeric, value: 1.0, expected: int64(1)},
+		{name: "numeric/float string", normalizer: solr.NormalizeNumeric, value: "1.50", expected: 1.5},
+		{name: "numeric/int", normalizer: solr.NormalizeNumeric, value: int32(3), expected: int64(3)},
+		{name: "numeric/json number", normalizer: solr.NormalizeNumeric, value: json.Number("2.0"), expected: int64(2)},
+		{name: "numeric/not number", normalizer: solr.NormalizeNumeric, value: "ten", expected: "ten"},
+		{
+			name:       "date/string",
+			normalizer: solr.NormalizeDate,
+			value:      "2024-01-02T12:00:00.1234+09:00",
+			expected:   time.Date(2024, 1, 2, 3, 0, 0, 123000000, time.UTC),
+		},
+		{
+			name:       "date/time",
+			normalizer: solr.NormalizeDate,
+			value:      time.Date(2024, 1, 2, 12, 0, 0, 999999, time.FixedZone("JST", 9*60*60)),
+			expected:   time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+		},
+		{name: "date/not date", normalizer: solr.NormalizeDate, value: "NOW", expected: "NOW"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.normalizer.Normalize(c.value)
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
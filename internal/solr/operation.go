@@ -0,0 +1,150 @@
+package solr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Operation is an atomic update operation.
+//
+// see: https://solr.apache.org/guide/solr/latest/indexing-guide/partial-document-updates.html
+type Operation string
+
+const (
+	OpSet         Operation = "set"
+	OpInc         Operation = "inc"
+	OpAdd         Operation = "add"
+	OpAddDistinct Operation = "add-distinct"
+	OpRemove      Operation = "remove"
+	OpRemoveRegex Operation = "removeregex"
+)
+
+// ParseOperation parses the name of an operation computed from the difference of a field.
+// removeregex is not accepted, because its regex can not be computed from the difference.
+func ParseOperation(s string) (Operation, error) {
+	switch op := Operation(s); op {
+	case OpSet, OpInc, OpAdd, OpAddDistinct, OpRemove:
+		return op, nil
+	case OpRemoveRegex:
+		return "", fmt.Errorf("operation %q can not be computed from the difference", s)
+	default:
+		return "", fmt.Errorf("unknown operation: %q", s)
+	}
+}
+
+// Update is an atomic update of a field.
+// InPlaceUpdateEncode writes a field whose value is Update or []Update as the operations.
+type Update struct {
+	Op    Operation
+	Value interface{}
+}
+
+// diffUpdates computes the atomic updates that change a field from old to new with op.
+// old is nil if the field is added, and equal compares the values of multi-valued fields.
+//
+//   - OpSet: set the new value.
+//   - OpInc: increment by the difference of integers. Floats, non-numeric values and differences
+//     that overflow int64 are set, because a float increment does not result in the exact new value.
+//   - OpAdd, OpAddDistinct: add the values that are only in new, and remove the values that are only in old.
+//     The order of values is not kept. If it can not be expressed by add and remove, the new values are set.
+//   - OpRemove: remove the values that are only in old. If values are added, the new values are set.
+func diffUpdates(op Operation, old, new interface{}, equal func(v1, v2 interface{}) bool) []Update {
+	switch op {
+	case OpInc:
+		if old == nil {
+			break
+		}
+		if delta, ok := intDelta(old, new); ok {
+			return []Update{{Op: OpInc, Value: delta}}
+		}
+	case OpRemove:
+		if old == nil {
+			break
+		}
+		oldValues, ok1 := multiValues(old)
+		newValues, ok2 := multiValues(new)
+		if !ok1 || !ok2 || len(subtractValues(newValues, oldValues, equal)) > 0 {
+			break
+		}
+		removed := subtractValues(oldValues, newValues, equal)
+		if len(removed) == 0 || len(subtractValues(removed, newValues, equal)) != len(removed) {
+			break
+		}
+		return []Update{{Op: OpRemove, Value: removed}}
+	case OpAdd, OpAddDistinct:
+		if old == nil {
+			old = []interface{}{}
+		}
+		oldValues, ok1 := multiValues(old)
+		newValues, ok2 := multiValues(new)
+		if !ok1 || !ok2 {
+			break
+		}
+
+		// "remove" removes all occurrences of the values,
+		// so values that are still in new can not be removed partially.
+		removed := subtractValues(oldValues, newValues, equal)
+		if len(subtractValues(removed, newValues, equal)) != len(removed) {
+			break
+		}
+
+		updates := make([]Update, 0, 2)
+		if len(removed) > 0 {
+			updates = append(updates, Update{Op: OpRemove, Value: removed})
+		}
+		if added := subtractValues(newValues, oldValues, equal); len(added) > 0 {
+			updates = append(updates, Update{Op: op, Value: added})
+		}
+		return updates
+	}
+	return []Update{{Op: OpSet, Value: new}}
+}
+
+// intDelta returns new - old of integers as int64.
+// ok is false if either is not an integer, or the difference overflows int64.
+func intDelta(old, new interface{}) (delta int64, ok bool) {
+	o := reflect.ValueOf(old)
+	n := reflect.ValueOf(new)
+	if !isInt(o) || !isInt(n) {
+		return 0, false
+	}
+	delta = n.Int() - o.Int()
+	if (o.Int() < 0) != (n.Int() < 0) && (delta < 0) != (n.Int() < 0) {
+		return 0, false
+	}
+	return delta, true
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// subtractValues returns the values of v1 that are not in v2 by equal, as a multiset.
+func subtractValues(v1, v2 []interface{}, equal func(v1, v2 interface{}) bool) []interface{} {
+	used := make([]bool, len(v2))
+	ret := make([]interface{}, 0)
+Outer:
+	for _, x := range v1 {
+		for i, y := range v2 {
+			if !used[i] && equal(x, y) {
+				used[i] = true
+				continue Outer
+			}
+		}
+		ret = append(ret, x)
+	}
+	return ret
+}
@@ -0,0 +1,241 @@
+package solr
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldPolicy is how the builder compares and updates a field.
+type FieldPolicy string
+
+const (
+	// PolicyReindex re-indexes the whole document if the field is changed.
+	PolicyReindex FieldPolicy = "reindex"
+	// PolicyIgnore neither compares nor sends the field.
+	PolicyIgnore FieldPolicy = "ignore"
+	// PolicyAlwaysSend sends the field with every update of the document, even if it is not changed.
+	PolicyAlwaysSend FieldPolicy = "always-send"
+	// PolicyAtomicSet updates the field by an atomic update {"set":value}.
+	PolicyAtomicSet FieldPolicy = "atomic-set"
+	// PolicyInPlace updates the field in-place. The field must be a docValues only field,
+	// so it can not be removed by an atomic update.
+	PolicyInPlace FieldPolicy = "in-place"
+	// PolicyIncrement updates an integer field by {"inc":delta}, and sets the other values.
+	PolicyIncrement FieldPolicy = "increment"
+	// PolicyAppendDistinct updates the multi-valued field by {"add-distinct":values} and {"remove":values}.
+	PolicyAppendDistinct FieldPolicy = "append-distinct"
+	// PolicyRemoveIfEmpty treats an empty value as a removed field, and removes it by {"set":null}.
+	PolicyRemoveIfEmpty FieldPolicy = "remove-if-empty"
+	// PolicyPassive updates the field by {"set":value}, but a change of the field does not trigger an update by itself.
+	// e.g. updated_at, which is changed whenever the source is exported.
+	PolicyPassive FieldPolicy = "passive"
+)
+
+// ParseFieldPolicy parses a policy name.
+func ParseFieldPolicy(s string) (FieldPolicy, error) {
+	switch p := FieldPolicy(s); p {
+	case PolicyReindex, PolicyIgnore, PolicyAlwaysSend, PolicyAtomicSet, PolicyInPlace,
+		PolicyIncrement, PolicyAppendDistinct, PolicyRemoveIfEmpty, PolicyPassive:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown field policy: %q", s)
+	}
+}
+
+// partial reports whether the field can be updated by an atomic update.
+func (p FieldPolicy) partial() bool {
+	switch p {
+	case PolicyReindex, PolicyIgnore:
+		return false
+	default:
+		return true
+	}
+}
+
+// operation returns the atomic update operation of the field.
+func (p FieldPolicy) operation() Operation {
+	switch p {
+	case PolicyIncrement:
+		return OpInc
+	case PolicyAppendDistinct:
+		return OpAddDistinct
+	default:
+		return OpSet
+	}
+}
+
+// Policy is the field policies of the builder.
+type Policy struct {
+	// Default is the policy of the fields not in Fields. The zero value is PolicyReindex.
+	Default FieldPolicy
+	Fields  map[string]FieldPolicy
+	// Normalize is the normalizers of the fields applied in order before the comparison.
+	Normalize map[string][]Normalizer
+}
+
+// PolicyFromFields returns the policy of allowed fields and in-place update fields.
+// Fields that are not allowed are ignored, and all fields are allowed if fields is nil.
+func PolicyFromFields(fields []string, inPlaceUpdateFields []string) Policy {
+	p := Policy{Default: PolicyReindex, Fields: make(map[string]FieldPolicy)}
+	if fields != nil {
+		p.Default = PolicyIgnore
+	}
+	for _, field := range fields {
+		p.Fields[field] = PolicyReindex
+	}
+	for _, field := range inPlaceUpdateFields {
+		p.Fields[field] = PolicyInPlace
+	}
+	return p
+}
+
+// Of returns the policy of the field.
+func (p Policy) Of(field string) FieldPolicy {
+	if policy, ok := p.Fields[field]; ok {
+		return policy
+	}
+	if p.Default == "" {
+		return PolicyReindex
+	}
+	return p.Default
+}
+
+// normalize returns the value of the field normalized for the comparison.
+// The fields of labeled child documents in the value are normalized by their own normalizers.
+func (p Policy) normalize(field string, v interface{}) interface{} {
+	if len(p.Normalize) == 0 {
+		return v
+	}
+	for _, n := range p.Normalize[field] {
+		v = n.Normalize(v)
+	}
+	if !hasChildDocuments(v) {
+		return v
+	}
+	if doc, ok := v.(Document); ok {
+		return p.normalizeDocument(doc)
+	}
+	values, _ := multiValues(v)
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = value
+		if doc, ok := value.(Document); ok {
+			ret[i] = p.normalizeDocument(doc)
+		}
+	}
+	return ret
+}
+
+// normalizeDocument returns the document whose fields and children are normalized for the comparison.
+func (p Policy) normalizeDocument(doc Document) Document {
+	if len(p.Normalize) == 0 {
+		return doc
+	}
+	ret := Document{
+		ID:     doc.ID,
+		Fields: make(Fields, len(doc.Fields)),
+	}
+	for i, field := range doc.Fields {
+		ret.Fields[i] = Field{Key: field.Key, Value: p.normalize(field.Key, field.Value)}
+	}
+	if doc.Children != nil {
+		ret.Children = make([]Document, len(doc.Children))
+		for i, child := range doc.Children {
+			ret.Children[i] = p.normalizeDocument(child)
+		}
+	}
+	return ret
+}
+
+// AllowedFields returns the sorted fields that are not ignored.
+// It returns nil if all fields are allowed except the ignored ones.
+func (p Policy) AllowedFields() []string {
+	if p.Default != PolicyIgnore {
+		return nil
+	}
+	return p.FieldsOf(func(policy FieldPolicy) bool { return policy != PolicyIgnore })
+}
+
+// FieldsOf returns the sorted fields whose policy matches.
+func (p Policy) FieldsOf(match func(FieldPolicy) bool) []string {
+	fields := make([]string, 0)
+	for field, policy := range p.Fields {
+		if match(policy) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// policyFile is the layout of a policy file.
+//
+//	default: ignore
+//	fields:
+//	  title: reindex
+//	  count_i: increment
+//	  updated_at: passive
+//	normalize:
+//	  title: [trim, nfc]
+//	  count_i: [numeric]
+type policyFile struct {
+	Default   string              `yaml:"default"`
+	Fields    map[string]string   `yaml:"fields"`
+	Normalize map[string][]string `yaml:"normalize"`
+}
+
+// LoadPolicy loads the policy from a YAML or JSON policy file.
+func LoadPolicy(r io.Reader) (Policy, error) {
+	var f policyFile
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil && err != io.EOF {
+		return Policy{}, err
+	}
+
+	p := Policy{Default: PolicyReindex, Fields: make(map[string]FieldPolicy, len(f.Fields))}
+	if f.Default != "" {
+		policy, err := ParseFieldPolicy(f.Default)
+		if err != nil {
+			return Policy{}, fmt.Errorf("default: %w", err)
+		}
+		p.Default = policy
+	}
+	for field, name := range f.Fields {
+		policy, err := ParseFieldPolicy(name)
+		if err != nil {
+			return Policy{}, fmt.Errorf("field %q: %w", field, err)
+		}
+		p.Fields[field] = policy
+	}
+	if len(f.Normalize) > 0 {
+		p.Normalize = make(map[string][]Normalizer, len(f.Normalize))
+	}
+	for field, names := range f.Normalize {
+		for _, name := range names {
+			n, err := ParseNormalizer(name)
+			if err != nil {
+				return Policy{}, fmt.Errorf("field %q: %w", field, err)
+			}
+			p.Normalize[field] = append(p.Normalize[field], n)
+		}
+	}
+	return p, nil
+}
+
+// isEmptyValue reports whether v is null, an empty string, or empty multi-values.
+func isEmptyValue(v interface{}) bool {
+	v = indirect(v)
+	if v == nil {
+		return true
+	}
+	if values, ok := multiValues(v); ok {
+		return len(values) == 0
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.String && rv.Len() == 0
+}
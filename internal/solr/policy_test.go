@@ -0,0 +1,141 @@
+package solr_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		raw      string
+		expected solr.Policy
+		wantErr  bool
+	}{
+		{
+			name: "yaml",
+			raw: `
+default: ignore
+fields:
+  title: reindex
+  count_i: increment
+  updated_at: passive
+`,
+			expected: solr.Policy{
+				Default: solr.PolicyIgnore,
+				Fields: map[string]solr.FieldPolicy{
+					"title":      solr.PolicyReindex,
+					"count_i":    solr.PolicyIncrement,
+					"updated_at": solr.PolicyPassive,
+				},
+			},
+		},
+		{
+			name: "json",
+			raw:  `{"fields":{"tags_ss":"append-distinct","note_s":"remove-if-empty"}}`,
+			expected: solr.Policy{
+				Default: solr.PolicyReindex,
+				Fields: map[string]solr.FieldPolicy{
+					"tags_ss": solr.PolicyAppendDistinct,
+					"note_s":  solr.PolicyRemoveIfEmpty,
+				},
+			},
+		},
+		{
+			name:     "empty",
+			raw:      ``,
+			expected: solr.Policy{Default: solr.PolicyReindex, Fields: map[string]solr.FieldPolicy{}},
+		},
+		{
+			name: "normalize",
+			raw: `
+fields:
+  title: atomic-set
+normalize:
+  title: [trim, nfc]
+`,
+			expected: solr.Policy{
+				Default:   solr.PolicyReindex,
+				Fields:    map[string]solr.FieldPolicy{"title": solr.PolicyAtomicSet},
+				Normalize: map[string][]solr.Normalizer{"title": {solr.NormalizeTrim, solr.NormalizeNFC}},
+			},
+		},
+		{
+			name:    "unknown normalizer",
+			raw:     `{"normalize":{"title":["upper"]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown policy",
+			raw:     `{"fields":{"title":"replace"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown default",
+			raw:     `default: all`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			raw:     `field: {title: reindex}`,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := solr.LoadPolicy(strings.NewReader(c.raw))
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, but got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.expected, got); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPolicy_AllowedFields(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   solr.Policy
+		expected []string
+	}{
+		{
+			name:     "all fields",
+			policy:   solr.PolicyFromFields(nil, []string{"int1"}),
+			expected: nil,
+		},
+		{
+			name:     "allowed fields",
+			policy:   solr.PolicyFromFields([]string{"str1", "int1"}, []string{"int2"}),
+			expected: []string{"int1", "int2", "str1"},
+		},
+		{
+			name: "ignored fields",
+			policy: solr.Policy{
+				Default: solr.PolicyIgnore,
+				Fields:  map[string]solr.FieldPolicy{"str1": solr.PolicyAtomicSet, "str2": solr.PolicyIgnore},
+			},
+			expected: []string{"str1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if diff := cmp.Diff(c.expected, c.policy.AllowedFields()); diff != "" {
+				t.Errorf("(-expected, +got)\n%s", diff)
+			}
+		})
+	}
+}
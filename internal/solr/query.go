@@ -0,0 +1,303 @@
+package solr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Get fetches the documents by ids with the real-time get handler (/get).
+// fields limits the fields of the documents (fl). All fields are returned if it is empty.
+// Documents that do not exist are not returned.
+func (c *Client) Get(ids []string, fields []string) ([]Document, error) {
+	params := url.Values{}
+	// "id" can be repeated, and unlike "ids" it allows ids that contain commas
+	for _, id := range ids {
+		params.Add("id", id)
+	}
+	if len(fields) > 0 {
+		params.Add("fl", strings.Join(fields, ","))
+	}
+	params.Add("wt", "json")
+
+	resp, err := c.httpClient.Get(c.url("get", params))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ret queryResponse
+	if err := decodeResponse(resp, &ret); err != nil {
+		return nil, err
+	}
+	// Solr returns a single id as "doc", which is null if the document does not exist
+	if ret.Doc != nil {
+		if string(ret.Doc) == "null" {
+			return []Document{}, nil
+		}
+		doc, err := DecodeJSONDocument(ret.Doc)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{doc}, nil
+	}
+	return ret.Response.documents()
+}
+
+// SelectParams is the parameters of a select request.
+type SelectParams struct {
+	// Query is q. "*:*" is used if it is empty.
+	Query         string
+	FilterQueries []string
+	// Fields is fl. All fields are returned if it is empty.
+	Fields []string
+	Sort   string
+
+	// Start and Rows are used for paging. Rows is not sent if it is not positive.
+	Start int
+	Rows  int
+	// CursorMark is used for deep paging instead of Start.
+	// "*" starts from the beginning, and Sort must include the unique key.
+	CursorMark string
+
+	// Extra is other parameters
+	Extra url.Values
+}
+
+func (p SelectParams) values() url.Values {
+	params := url.Values{}
+	for k, v := range p.Extra {
+		params[k] = append([]string(nil), v...)
+	}
+
+	q := p.Query
+	if q == "" {
+		q = "*:*"
+	}
+	params.Set("q", q)
+	for _, fq := range p.FilterQueries {
+		params.Add("fq", fq)
+	}
+	if len(p.Fields) > 0 {
+		params.Set("fl", strings.Join(p.Fields, ","))
+	}
+	if p.Sort != "" {
+		params.Set("sort", p.Sort)
+	}
+	if p.Start > 0 {
+		params.Set("start", strconv.Itoa(p.Start))
+	}
+	if p.Rows > 0 {
+		params.Set("rows", strconv.Itoa(p.Rows))
+	}
+	if p.CursorMark != "" {
+		params.Set("cursorMark", p.CursorMark)
+	}
+	params.Set("wt", "json")
+	return params
+}
+
+type SelectResponse struct {
+	NumFound int64
+	Start    int64
+	Docs     []Document
+	// NextCursorMark is set if CursorMark is requested.
+	NextCursorMark string
+}
+
+// Select searches the documents with the select handler (/select).
+func (c *Client) Select(params SelectParams) (*SelectResponse, error) {
+	resp, err := c.httpClient.Get(c.url("select", params.values()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ret queryResponse
+	if err := decodeResponse(resp, &ret); err != nil {
+		return nil, err
+	}
+	docs, err := ret.Response.documents()
+	if err != nil {
+		return nil, err
+	}
+	return &SelectResponse{
+		NumFound:       ret.Response.NumFound,
+		Start:          ret.Response.Start,
+		Docs:           docs,
+		NextCursorMark: ret.NextCursorMark,
+	}, nil
+}
+
+// SelectAll iterates all documents matched by params with cursorMark.
+// The unique key "id" is added to Sort as a tie-breaker, and Rows is the page size (default: 100).
+// Start and CursorMark of params are ignored.
+func (c *Client) SelectAll(params SelectParams) iter.Seq2[Document, error] {
+	return func(yield func(Document, error) bool) {
+		params.Start = 0
+		params.CursorMark = "*"
+		if params.Rows <= 0 {
+			params.Rows = 100
+		}
+		params.Sort = sortWithUniqueKey(params.Sort)
+
+		for {
+			resp, err := c.Select(params)
+			if err != nil {
+				yield(Document{}, err)
+				return
+			}
+			for _, doc := range resp.Docs {
+				if !yield(doc, nil) {
+					return
+				}
+			}
+			// the cursor is not moved if all documents are returned
+			if resp.NextCursorMark == "" || resp.NextCursorMark == params.CursorMark {
+				return
+			}
+			params.CursorMark = resp.NextCursorMark
+		}
+	}
+}
+
+func sortWithUniqueKey(sort string) string {
+	for _, clause := range strings.Split(sort, ",") {
+		if fields := strings.Fields(clause); len(fields) > 0 && fields[0] == "id" {
+			return sort
+		}
+	}
+	if sort == "" {
+		return "id asc"
+	}
+	return sort + ",id asc"
+}
+
+type queryResponse struct {
+	Response docList `json:"response"`
+	// Doc is the document of a real-time get of a single id.
+	Doc            json.RawMessage `json:"doc"`
+	NextCursorMark string          `json:"nextCursorMark"`
+}
+
+type docList struct {
+	NumFound int64             `json:"numFound"`
+	Start    int64             `json:"start"`
+	Docs     []json.RawMessage `json:"docs"`
+}
+
+func (l *docList) documents() ([]Document, error) {
+	docs := make([]Document, 0, len(l.Docs))
+	for _, raw := range l.Docs {
+		doc, err := DecodeJSONDocument(raw)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// DecodeJSONDocument decodes a JSON object into a document, such as a document of a Solr response.
+// Integers are decoded as int64, other numbers as float64, and arrays as multi-values.
+// Objects are child documents: _childDocuments_ are anonymous children, and the others are labeled ones.
+// Fields are sorted by name.
+func DecodeJSONDocument(raw []byte) (Document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var m map[string]interface{}
+	if err := decoder.Decode(&m); err != nil {
+		return Document{}, err
+	}
+	return decodeDocument(m)
+}
+
+func decodeDocument(m map[string]interface{}) (Document, error) {
+	var id string
+	switch v := m["id"].(type) {
+	case string:
+		id = v
+	case json.Number:
+		id = v.String()
+	default:
+		return Document{}, errors.New("document should contains id field")
+	}
+
+	doc := Document{
+		ID:     id,
+		Fields: make(Fields, 0, len(m)-1),
+	}
+	for key, value := range m {
+		if key == "id" {
+			continue
+		}
+		if key == ChildDocumentsField {
+			children, err := decodeChildren(value)
+			if err != nil {
+				return Document{}, fmt.Errorf("child documents of %q: %w", id, err)
+			}
+			doc.Children = children
+			continue
+		}
+		v, err := decodeValue(value)
+		if err != nil {
+			return Document{}, fmt.Errorf("field %q: %w", key, err)
+		}
+		doc.Fields = append(doc.Fields, Field{Key: key, Value: v})
+	}
+	sort.Slice(doc.Fields, func(i, j int) bool {
+		return doc.Fields[i].Key < doc.Fields[j].Key
+	})
+	return doc, nil
+}
+
+func decodeChildren(v interface{}) ([]Document, error) {
+	values, ok := v.([]interface{})
+	if !ok {
+		values = []interface{}{v}
+	}
+	children := make([]Document, 0, len(values))
+	for _, value := range values {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("child document should be an object, but got %T", value)
+		}
+		child, err := decodeDocument(m)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+func decodeValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			value, err := decodeValue(v[i])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case map[string]interface{}:
+		return decodeDocument(v)
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,114 @@
+package solr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type ResponseHeader struct {
+	Status int `json:"status"`
+	QTime  int `json:"QTime"`
+
+	// Errors is the errors of each document.
+	// They are reported when the request is processed with TolerantUpdateProcessor.
+	Errors []DocumentError `json:"errors,omitempty"`
+}
+
+// DocumentError is an error of a document in an update request.
+type DocumentError struct {
+	// Type is "ADD", "DELID" or "DELQ"
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// VersionConflict reports whether the document is rejected by optimistic concurrency.
+func (e DocumentError) VersionConflict() bool {
+	return strings.Contains(e.Message, "version conflict")
+}
+
+// ErrorDetail is the "error" block of a Solr response.
+type ErrorDetail struct {
+	Metadata []string `json:"metadata,omitempty"`
+	Msg      string   `json:"msg"`
+	Code     int      `json:"code"`
+}
+
+type UpdateResponse struct {
+	ResponseHeader ResponseHeader `json:"responseHeader"`
+	Error          *ErrorDetail   `json:"error,omitempty"`
+}
+
+// VersionConflicts returns the documents rejected by version conflicts.
+func (r *UpdateResponse) VersionConflicts() []DocumentError {
+	ret := make([]DocumentError, 0)
+	for _, e := range r.ResponseHeader.Errors {
+		if e.VersionConflict() {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// SolrError is returned when Solr fails to process a request.
+type SolrError struct {
+	// StatusCode is the HTTP status code
+	StatusCode int
+	// Code and Msg are from the "error" block.
+	// If the response is not JSON, Msg is the response body.
+	Code     int
+	Msg      string
+	Metadata []string
+
+	ResponseHeader ResponseHeader
+}
+
+func (e *SolrError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("solr error: status=%d", e.StatusCode)
+	}
+	return fmt.Sprintf("solr error: status=%d code=%d: %s", e.StatusCode, e.Code, e.Msg)
+}
+
+// VersionConflict reports whether the request is rejected by a version conflict.
+func (e *SolrError) VersionConflict() bool {
+	return e.Code == http.StatusConflict
+}
+
+// decodeResponse decodes the JSON response into v.
+// It returns *SolrError if Solr fails to process the request.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var r UpdateResponse
+	jsonErr := json.Unmarshal(body, &r)
+	if resp.StatusCode/100 != 2 || jsonErr != nil || r.Error != nil || r.ResponseHeader.Status != 0 {
+		solrErr := &SolrError{
+			StatusCode:     resp.StatusCode,
+			ResponseHeader: r.ResponseHeader,
+		}
+		switch {
+		case r.Error != nil:
+			solrErr.Code = r.Error.Code
+			solrErr.Msg = r.Error.Msg
+			solrErr.Metadata = r.Error.Metadata
+		case jsonErr != nil:
+			solrErr.Code = resp.StatusCode
+			solrErr.Msg = strings.TrimSpace(string(body))
+		default:
+			solrErr.Code = resp.StatusCode
+		}
+		return solrErr
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,378 @@
+package solr
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldProperties is the properties of a field or a field type.
+// nil means that the property is not specified.
+type FieldProperties struct {
+	Indexed     *bool
+	Stored      *bool
+	DocValues   *bool
+	MultiValued *bool
+}
+
+// merge returns the properties that p overrides base.
+func (p FieldProperties) merge(base FieldProperties) FieldProperties {
+	ret := base
+	if p.Indexed != nil {
+		ret.Indexed = p.Indexed
+	}
+	if p.Stored != nil {
+		ret.Stored = p.Stored
+	}
+	if p.DocValues != nil {
+		ret.DocValues = p.DocValues
+	}
+	if p.MultiValued != nil {
+		ret.MultiValued = p.MultiValued
+	}
+	return ret
+}
+
+type FieldType struct {
+	Name  string
+	Class string
+	FieldProperties
+}
+
+// SchemaField is a field or a dynamic field of the schema.
+// Name of a dynamic field is a pattern like "*_i".
+type SchemaField struct {
+	Name string
+	Type string
+	FieldProperties
+}
+
+type CopyField struct {
+	Source string
+	Dest   string
+}
+
+type Schema struct {
+	UniqueKey     string
+	Fields        []SchemaField
+	DynamicFields []SchemaField
+	FieldTypes    []FieldType
+	CopyFields    []CopyField
+}
+
+// ResolvedField is a schema field whose properties are resolved with the field type.
+type ResolvedField struct {
+	Name        string
+	Type        FieldType
+	Indexed     bool
+	Stored      bool
+	DocValues   bool
+	MultiValued bool
+}
+
+// numericFieldClasses is the field type classes that can be updated in-place.
+var numericFieldClasses = []string{
+	"IntPointField",
+	"LongPointField",
+	"FloatPointField",
+	"DoublePointField",
+	"DatePointField",
+	"TrieIntField",
+	"TrieLongField",
+	"TrieFloatField",
+	"TrieDoubleField",
+	"TrieDateField",
+}
+
+// Field resolves the field by name. Dynamic fields are matched if there is no such field.
+// Like Solr, the longest dynamic field pattern is matched first.
+func (s *Schema) Field(name string) (ResolvedField, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return s.resolve(name, f)
+		}
+	}
+
+	dynamicFields := make([]SchemaField, len(s.DynamicFields))
+	copy(dynamicFields, s.DynamicFields)
+	sort.SliceStable(dynamicFields, func(i, j int) bool {
+		return len(dynamicFields[i].Name) > len(dynamicFields[j].Name)
+	})
+	for _, f := range dynamicFields {
+		if matchDynamicField(f.Name, name) {
+			return s.resolve(name, f)
+		}
+	}
+	return ResolvedField{}, false
+}
+
+func (s *Schema) resolve(name string, f SchemaField) (ResolvedField, bool) {
+	var fieldType FieldType
+	found := false
+	for _, t := range s.FieldTypes {
+		if t.Name == f.Type {
+			fieldType = t
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ResolvedField{}, false
+	}
+
+	props := f.FieldProperties.merge(fieldType.FieldProperties)
+	return ResolvedField{
+		Name:        name,
+		Type:        fieldType,
+		Indexed:     boolOr(props.Indexed, true),
+		Stored:      boolOr(props.Stored, true),
+		DocValues:   boolOr(props.DocValues, false),
+		MultiValued: boolOr(props.MultiValued, false),
+	}, true
+}
+
+func matchDynamicField(pattern, name string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(name, pattern[1:])
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(name, pattern[:len(pattern)-1])
+	default:
+		return pattern == name
+	}
+}
+
+// InPlaceUpdatable reports whether the field can be updated in-place.
+// The field must be a single-valued, non-indexed, non-stored numeric docValues field,
+// and the destinations of its copy fields must also be updatable in-place.
+//
+// see: https://solr.apache.org/guide/solr/latest/indexing-guide/partial-document-updates.html#in-place-updates
+func (s *Schema) InPlaceUpdatable(name string) bool {
+	if name == "_version_" || name == s.UniqueKey {
+		return false
+	}
+	if !s.inPlaceUpdatable(name) {
+		return false
+	}
+	for _, cf := range s.CopyFields {
+		if matchDynamicField(cf.Source, name) && !s.inPlaceUpdatable(cf.Dest) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Schema) inPlaceUpdatable(name string) bool {
+	f, ok := s.Field(name)
+	if !ok {
+		return false
+	}
+	if f.Indexed || f.Stored || !f.DocValues || f.MultiValued {
+		return false
+	}
+	return contains(numericFieldClasses, strings.TrimPrefix(f.Type.Class, "solr."))
+}
+
+// InPlaceUpdateFields returns the fields that can be updated in-place.
+func (s *Schema) InPlaceUpdateFields(fields []string) []string {
+	ret := make([]string, 0)
+	for _, f := range fields {
+		if s.InPlaceUpdatable(f) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func boolOr(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+// xmlSchema is schema.xml, whose definitions are either in <schema>,
+// or wrapped in <types> and <fields> as in the legacy layout.
+// fieldtype is the legacy name of fieldType.
+type xmlSchema struct {
+	UniqueKey     string         `xml:"uniqueKey"`
+	Fields        []xmlField     `xml:"field"`
+	DynamicFields []xmlField     `xml:"dynamicField"`
+	FieldTypes    []xmlFieldType `xml:"fieldType"`
+	CopyFields    []CopyField    `xml:"copyField"`
+
+	LegacyFields          []xmlField     `xml:"fields>field"`
+	LegacyDynamicFields   []xmlField     `xml:"fields>dynamicField"`
+	LegacyFieldTypes      []xmlFieldType `xml:"types>fieldType"`
+	LowerFieldTypes       []xmlFieldType `xml:"fieldtype"`
+	LowerLegacyFieldTypes []xmlFieldType `xml:"types>fieldtype"`
+}
+
+type xmlProperties struct {
+	Indexed     string `xml:"indexed,attr"`
+	Stored      string `xml:"stored,attr"`
+	DocValues   string `xml:"docValues,attr"`
+	MultiValued string `xml:"multiValued,attr"`
+}
+
+type xmlField struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+	xmlProperties
+}
+
+type xmlFieldType struct {
+	Name  string `xml:"name,attr"`
+	Class string `xml:"class,attr"`
+	xmlProperties
+}
+
+func (p xmlProperties) properties() (FieldProperties, error) {
+	var (
+		props FieldProperties
+		err   error
+	)
+	parse := func(s string) *bool {
+		if s == "" || err != nil {
+			return nil
+		}
+		b, e := strconv.ParseBool(s)
+		if e != nil {
+			err = e
+			return nil
+		}
+		return &b
+	}
+	props.Indexed = parse(p.Indexed)
+	props.Stored = parse(p.Stored)
+	props.DocValues = parse(p.DocValues)
+	props.MultiValued = parse(p.MultiValued)
+	return props, err
+}
+
+func (c *CopyField) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "source":
+			c.Source = attr.Value
+		case "dest":
+			c.Dest = attr.Value
+		}
+	}
+	return d.Skip()
+}
+
+// LoadSchemaXML loads the schema from schema.xml (or managed-schema).
+func LoadSchemaXML(r io.Reader) (*Schema, error) {
+	var x xmlSchema
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{
+		UniqueKey:  strings.TrimSpace(x.UniqueKey),
+		CopyFields: x.CopyFields,
+	}
+	convert := func(fields []xmlField) ([]SchemaField, error) {
+		ret := make([]SchemaField, 0, len(fields))
+		for _, f := range fields {
+			props, err := f.properties()
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", f.Name, err)
+			}
+			ret = append(ret, SchemaField{Name: f.Name, Type: f.Type, FieldProperties: props})
+		}
+		return ret, nil
+	}
+
+	var err error
+	if schema.Fields, err = convert(slices.Concat(x.Fields, x.LegacyFields)); err != nil {
+		return nil, err
+	}
+	if len(schema.Fields) == 0 {
+		return nil, errors.New("no field is found in schema.xml")
+	}
+	if schema.DynamicFields, err = convert(slices.Concat(x.DynamicFields, x.LegacyDynamicFields)); err != nil {
+		return nil, err
+	}
+	for _, t := range slices.Concat(x.FieldTypes, x.LegacyFieldTypes, x.LowerFieldTypes, x.LowerLegacyFieldTypes) {
+		props, err := t.properties()
+		if err != nil {
+			return nil, fmt.Errorf("field type %q: %w", t.Name, err)
+		}
+		schema.FieldTypes = append(schema.FieldTypes, FieldType{Name: t.Name, Class: t.Class, FieldProperties: props})
+	}
+	return schema, nil
+}
+
+type jsonProperties struct {
+	Indexed     *bool `json:"indexed"`
+	Stored      *bool `json:"stored"`
+	DocValues   *bool `json:"docValues"`
+	MultiValued *bool `json:"multiValued"`
+}
+
+type jsonField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	jsonProperties
+}
+
+type jsonFieldType struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+	jsonProperties
+}
+
+type jsonSchemaResponse struct {
+	Schema struct {
+		UniqueKey     string          `json:"uniqueKey"`
+		Fields        []jsonField     `json:"fields"`
+		DynamicFields []jsonField     `json:"dynamicFields"`
+		FieldTypes    []jsonFieldType `json:"fieldTypes"`
+		CopyFields    []struct {
+			Source string `json:"source"`
+			Dest   string `json:"dest"`
+		} `json:"copyFields"`
+	} `json:"schema"`
+}
+
+func (p jsonProperties) properties() FieldProperties {
+	return FieldProperties{
+		Indexed:     p.Indexed,
+		Stored:      p.Stored,
+		DocValues:   p.DocValues,
+		MultiValued: p.MultiValued,
+	}
+}
+
+// LoadSchemaJSON loads the schema from the response of Solr's Schema API.
+func LoadSchemaJSON(r io.Reader) (*Schema, error) {
+	var resp jsonSchemaResponse
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{
+		UniqueKey: resp.Schema.UniqueKey,
+	}
+	for _, f := range resp.Schema.Fields {
+		schema.Fields = append(schema.Fields, SchemaField{Name: f.Name, Type: f.Type, FieldProperties: f.properties()})
+	}
+	for _, f := range resp.Schema.DynamicFields {
+		schema.DynamicFields = append(schema.DynamicFields, SchemaField{Name: f.Name, Type: f.Type, FieldProperties: f.properties()})
+	}
+	for _, t := range resp.Schema.FieldTypes {
+		schema.FieldTypes = append(schema.FieldTypes, FieldType{Name: t.Name, Class: t.Class, FieldProperties: t.properties()})
+	}
+	for _, cf := range resp.Schema.CopyFields {
+		schema.CopyFields = append(schema.CopyFields, CopyField{Source: cf.Source, Dest: cf.Dest})
+	}
+	return schema, nil
+}
@@ -0,0 +1,154 @@
+package solr_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+const testSchemaXML = `<?xml version="1.0" encoding="UTF-8" ?>
+<schema name="default" version="1.6">
+  <field name="_version_" type="plong" indexed="false" stored="false"/>
+  <field name="id" type="string" indexed="true" stored="true" required="true" multiValued="false"/>
+  <field name="title" type="text_general" indexed="true" stored="true"/>
+  <field name="popularity" type="pint" indexed="false" stored="false"/>
+  <field name="price" type="pfloat" indexed="false" stored="false"/>
+  <field name="stock" type="pint"/>
+  <field name="copied" type="pint" indexed="false" stored="false"/>
+  <field name="copied_dest" type="pint"/>
+  <field name="tags" type="pint" indexed="false" stored="false" multiValued="true"/>
+  <field name="no_dv" type="pint" indexed="false" stored="false" docValues="false"/>
+  <field name="str_dv" type="string" indexed="false" stored="false" docValues="true"/>
+
+  <dynamicField name="*_i" type="pint" indexed="true" stored="true"/>
+  <dynamicField name="*_dv_i" type="pint" indexed="false" stored="false"/>
+  <dynamicField name="*_s" type="string" indexed="true" stored="true"/>
+  <dynamicField name="attr_*" type="plong" indexed="false" stored="false"/>
+
+  <fieldType name="string" class="solr.StrField" sortMissingLast="true"/>
+  <fieldType name="pint" class="solr.IntPointField" docValues="true"/>
+  <fieldType name="plong" class="solr.LongPointField" docValues="true"/>
+  <fieldType name="pfloat" class="solr.FloatPointField" docValues="true"/>
+  <fieldType name="text_general" class="solr.TextField" positionIncrementGap="100"/>
+
+  <uniqueKey>id</uniqueKey>
+
+  <copyField source="copied" dest="copied_dest"/>
+</schema>
+`
+
+const testSchemaJSON = `{
+  "responseHeader": {"status": 0, "QTime": 1},
+  "schema": {
+    "name": "default",
+    "version": 1.6,
+    "uniqueKey": "id",
+    "fieldTypes": [
+      {"name": "pint", "class": "solr.IntPointField", "docValues": true},
+      {"name": "string", "class": "solr.StrField"}
+    ],
+    "fields": [
+      {"name": "id", "type": "string", "indexed": true, "stored": true},
+      {"name": "popularity", "type": "pint", "indexed": false, "stored": false},
+      {"name": "stock", "type": "pint"}
+    ],
+    "dynamicFields": [
+      {"name": "*_dv_i", "type": "pint", "indexed": false, "stored": false}
+    ],
+    "copyFields": []
+  }
+}`
+
+func TestSchema_InPlaceUpdatable(t *testing.T) {
+	xmlSchema, err := solr.LoadSchemaXML(strings.NewReader(testSchemaXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonSchema, err := solr.LoadSchemaJSON(strings.NewReader(testSchemaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		schema   *solr.Schema
+		field    string
+		expected bool
+	}{
+		{name: "xml/numeric docValues only", schema: xmlSchema, field: "popularity", expected: true},
+		{name: "xml/float docValues only", schema: xmlSchema, field: "price", expected: true},
+		{name: "xml/indexed and stored", schema: xmlSchema, field: "stock", expected: false},
+		{name: "xml/text", schema: xmlSchema, field: "title", expected: false},
+		{name: "xml/unique key", schema: xmlSchema, field: "id", expected: false},
+		{name: "xml/version", schema: xmlSchema, field: "_version_", expected: false},
+		{name: "xml/copy field source", schema: xmlSchema, field: "copied", expected: false},
+		{name: "xml/multi-valued", schema: xmlSchema, field: "tags", expected: false},
+		{name: "xml/docValues disabled", schema: xmlSchema, field: "no_dv", expected: false},
+		{name: "xml/not numeric", schema: xmlSchema, field: "str_dv", expected: false},
+		{name: "xml/dynamic field", schema: xmlSchema, field: "count_i", expected: false},
+		{name: "xml/longest dynamic field", schema: xmlSchema, field: "count_dv_i", expected: true},
+		{name: "xml/prefix dynamic field", schema: xmlSchema, field: "attr_size", expected: true},
+		{name: "xml/unknown field", schema: xmlSchema, field: "unknown", expected: false},
+		{name: "json/numeric docValues only", schema: jsonSchema, field: "popularity", expected: true},
+		{name: "json/indexed and stored", schema: jsonSchema, field: "stock", expected: false},
+		{name: "json/dynamic field", schema: jsonSchema, field: "count_dv_i", expected: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.schema.InPlaceUpdatable(c.field); got != c.expected {
+				t.Fatalf("expected %v, but got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadSchemaXML_Legacy(t *testing.T) {
+	// legacy schema.xml wraps the definitions in <types> and <fields>
+	schema, err := solr.LoadSchemaXML(strings.NewReader(`<?xml version="1.0" encoding="UTF-8" ?>
+<schema name="legacy" version="1.5">
+  <types>
+    <fieldType name="string" class="solr.StrField"/>
+    <fieldtype name="tint" class="solr.TrieIntField" docValues="true"/>
+  </types>
+  <fields>
+    <field name="id" type="string" indexed="true" stored="true" required="true"/>
+    <field name="popularity" type="tint" indexed="false" stored="false"/>
+    <dynamicField name="*_dv_i" type="tint" indexed="false" stored="false"/>
+  </fields>
+  <uniqueKey>id</uniqueKey>
+</schema>
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := schema.InPlaceUpdateFields([]string{"id", "popularity", "count_dv_i"})
+	expected := []string{"popularity", "count_dv_i"}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("diff: %s", diff)
+	}
+}
+
+func TestLoadSchemaXML_NoFields(t *testing.T) {
+	_, err := solr.LoadSchemaXML(strings.NewReader(`<schema name="empty" version="1.6"><uniqueKey>id</uniqueKey></schema>`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSchema_InPlaceUpdateFields(t *testing.T) {
+	schema, err := solr.LoadSchemaXML(strings.NewReader(testSchemaXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := schema.InPlaceUpdateFields([]string{"id", "title", "popularity", "count_i", "count_dv_i"})
+	expected := []string{"popularity", "count_dv_i"}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("diff: %s", diff)
+	}
+}
@@ -0,0 +1,163 @@
+package solr
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// XMLEncoder encodes update requests in the XML format for handlers that do not accept JSON.
+//
+//	<update><add><doc><field name="id">1</field><field name="count_i" update="inc">1</field></doc></add><delete><id>2</id></delete></update>
+type XMLEncoder struct{}
+
+func (XMLEncoder) ContentType() string {
+	return "application/xml"
+}
+
+func (XMLEncoder) Layout() Layout {
+	return Layout{
+		Begin: "<update>",
+		End:   "</update>",
+		DeleteByID: Group{
+			Begin: "<delete>",
+			End:   "</delete>",
+		},
+		DeleteByQuery: Group{
+			Begin: "<delete>",
+			End:   "</delete>",
+		},
+	}
+}
+
+// EncodeAdd encodes `<add><doc>...</doc></add>`.
+// Multi-values are written as repeated fields. A null value is written as the null attribute,
+// which removes the field by an atomic update and is ignored otherwise.
+// Anonymous child documents are nested docs, and labeled ones are docs in the field.
+func (XMLEncoder) EncodeAdd(doc *Document, atomic bool) (string, error) {
+	var buf strings.Builder
+	buf.WriteString("<add>")
+	if err := writeXMLDoc(&buf, doc, atomic); err != nil {
+		return "", err
+	}
+	buf.WriteString("</add>")
+	return buf.String(), nil
+}
+
+func writeXMLDoc(buf *strings.Builder, doc *Document, atomic bool) error {
+	buf.WriteString("<doc>")
+	writeXMLField(buf, "id", "", doc.ID)
+	for _, field := range doc.Fields {
+		var err error
+		if atomic && field.Key != VersionField {
+			err = writeXMLUpdateField(buf, field.Key, field.Value)
+		} else {
+			err = writeXMLValues(buf, field.Key, "", field.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("field %q: %w", field.Key, err)
+		}
+	}
+	for _, child := range doc.Children {
+		if err := writeXMLDoc(buf, &child, false); err != nil {
+			return fmt.Errorf("child documents of %q: %w", doc.ID, err)
+		}
+	}
+	buf.WriteString("</doc>")
+	return nil
+}
+
+func (XMLEncoder) EncodeDeleteID(id string) string {
+	var buf strings.Builder
+	buf.WriteString("<id>")
+	xml.EscapeText(&buf, []byte(id))
+	buf.WriteString("</id>")
+	return buf.String()
+}
+
+// EncodeDeleteQuery encodes `<query>#{query}</query>`.
+// The XML format does not support _route_ and _version_ of delete-by-query.
+func (XMLEncoder) EncodeDeleteQuery(query DeleteQuery) (string, error) {
+	if query.Route != "" || query.Version != 0 {
+		return "", errors.New("_route_ and _version_ of delete-by-query are not supported in xml")
+	}
+	var buf strings.Builder
+	buf.WriteString("<query>")
+	xml.EscapeText(&buf, []byte(query.Query))
+	buf.WriteString("</query>")
+	return buf.String(), nil
+}
+
+func writeXMLUpdateField(buf *strings.Builder, key string, value interface{}) error {
+	for _, update := range updatesOf(value) {
+		values, ok := multiValues(indirect(update.Value))
+		if ok && len(values) == 0 && update.Op == OpSet {
+			// an empty list is the same as null for "set"
+			writeXMLNull(buf, key, string(update.Op))
+			continue
+		}
+		if err := writeXMLValues(buf, key, string(update.Op), update.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeXMLValues writes a field per value.
+func writeXMLValues(buf *strings.Builder, key, op string, value interface{}) error {
+	value = indirect(value)
+	if values, ok := multiValues(value); ok {
+		for _, v := range values {
+			if err := writeXMLValues(buf, key, op, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if value == nil {
+		writeXMLNull(buf, key, op)
+		return nil
+	}
+	if doc, ok := value.(Document); ok {
+		writeXMLFieldStart(buf, key, op)
+		buf.WriteString(">")
+		if err := writeXMLDoc(buf, &doc, false); err != nil {
+			return err
+		}
+		buf.WriteString("</field>")
+		return nil
+	}
+
+	text, _, err := formatScalar(value)
+	if err != nil {
+		return err
+	}
+	writeXMLField(buf, key, op, text)
+	return nil
+}
+
+// writeXMLField writes `<field name="#{key}" update="#{op}">#{text}</field>`.
+func writeXMLField(buf *strings.Builder, key, op, text string) {
+	writeXMLFieldStart(buf, key, op)
+	buf.WriteString(">")
+	xml.EscapeText(buf, []byte(text))
+	buf.WriteString("</field>")
+}
+
+// writeXMLNull writes `<field name="#{key}" update="#{op}" null="true"/>`.
+func writeXMLNull(buf *strings.Builder, key, op string) {
+	writeXMLFieldStart(buf, key, op)
+	buf.WriteString(` null="true"/>`)
+}
+
+func writeXMLFieldStart(buf *strings.Builder, key, op string) {
+	buf.WriteString(`<field name="`)
+	xml.EscapeText(buf, []byte(key))
+	buf.WriteString(`"`)
+	if op != "" {
+		buf.WriteString(` update="`)
+		xml.EscapeText(buf, []byte(op))
+		buf.WriteString(`"`)
+	}
+}
@@ -0,0 +1,175 @@
+package solr_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/imishinist/solr-inplace-poc/internal/solr"
+)
+
+func TestXMLEncoder_EncodeAdd(t *testing.T) {
+	cases := []struct {
+		name     string
+		doc      solr.Document
+		atomic   bool
+		expected string
+	}{
+		{
+			name: "simple document",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "int_1", Value: 10},
+					{Key: "str_1", Value: "foo"},
+					{Key: "float_1", Value: 10.5},
+					{Key: "bool_1", Value: true},
+				},
+			},
+			expected: `<add><doc><field name="id">1</field>` +
+				`<field name="int_1">10</field><field name="str_1">foo</field>` +
+				`<field name="float_1">10.5</field><field name="bool_1">true</field>` +
+				`</doc></add>`,
+		},
+		{
+			name: "escape",
+			doc: solr.Document{
+				ID: `1&"2"`,
+				Fields: []solr.Field{
+					{Key: "str_1", Value: "<a href=\"x\">&amp;</a>\x00"},
+				},
+			},
+			expected: `<add><doc><field name="id">1&amp;&#34;2&#34;</field>` +
+				`<field name="str_1">&lt;a href=&#34;x&#34;&gt;&amp;amp;&lt;/a&gt;` + "�" + `</field>` +
+				`</doc></add>`,
+		},
+		{
+			name: "multi-valued fields and nulls",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "tags_s", Value: []string{"a", "b"}},
+					{Key: "empty_s", Value: []string{}},
+					{Key: "null_s", Value: nil},
+				},
+			},
+			expected: `<add><doc><field name="id">1</field>` +
+				`<field name="tags_s">a</field><field name="tags_s">b</field>` +
+				`<field name="null_s" null="true"/>` +
+				`</doc></add>`,
+		},
+		{
+			name: "atomic update",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "int_1", Value: 10},
+					{Key: "count_i", Value: solr.Update{Op: solr.OpInc, Value: -1}},
+					{Key: "tags_s", Value: []solr.Update{
+						{Op: solr.OpRemove, Value: []string{"a"}},
+						{Op: solr.OpAddDistinct, Value: []string{"b", "c"}},
+					}},
+					{Key: "removed_s", Value: solr.Update{Op: solr.OpSet, Value: nil}},
+					{Key: "empty_s", Value: []string{}},
+					{Key: solr.VersionField, Value: int64(12345)},
+				},
+			},
+			atomic: true,
+			expected: `<add><doc><field name="id">1</field>` +
+				`<field name="int_1" update="set">10</field>` +
+				`<field name="count_i" update="inc">-1</field>` +
+				`<field name="tags_s" update="remove">a</field>` +
+				`<field name="tags_s" update="add-distinct">b</field>` +
+				`<field name="tags_s" update="add-distinct">c</field>` +
+				`<field name="removed_s" update="set" null="true"/>` +
+				`<field name="empty_s" update="set" null="true"/>` +
+				`<field name="_version_">12345</field>` +
+				`</doc></add>`,
+		},
+		{
+			name: "child documents",
+			doc: solr.Document{
+				ID: "1",
+				Fields: []solr.Field{
+					{Key: "comments", Value: []solr.Document{{ID: "1-c1"}, {ID: "1-c2"}}},
+				},
+				Children: []solr.Document{
+					{ID: "1-1", Fields: []solr.Field{{Key: "str_s", Value: "child"}}},
+				},
+			},
+			expected: `<add><doc><field name="id">1</field>` +
+				`<field name="comments"><doc><field name="id">1-c1</field></doc></field>` +
+				`<field name="comments"><doc><field name="id">1-c2</field></doc></field>` +
+				`<doc><field name="id">1-1</field><field name="str_s">child</field></doc>` +
+				`</doc></add>`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := solr.XMLEncoder{}.EncodeAdd(&c.doc, c.atomic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("\nexpected: %v\n but got: %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBatchBuilder_BuildXML(t *testing.T) {
+	builder := solr.NewUpdateBatchBuilder([]string{"int_1", "str_1"}, []string{"int_1"})
+	builder.SetEncoder(solr.XMLEncoder{})
+	builder.Update(
+		solr.Document{ID: "1", Fields: []solr.Field{{Key: "int_1", Value: 11}, {Key: "str_1", Value: "a"}}},
+		solr.Document{ID: "1", Fields: []solr.Field{{Key: "int_1", Value: 10}, {Key: "str_1", Value: "a"}}},
+	)
+	builder.Add(solr.Document{ID: "2", Fields: []solr.Field{{Key: "int_1", Value: 20}, {Key: "str_1", Value: "b"}}})
+	builder.Delete(solr.Document{ID: "3"}, solr.Document{ID: "4"})
+	builder.DeleteByQuery(solr.DeleteQuery{Query: "str_1:<x>"}, solr.DeleteQuery{Query: "int_1:0"})
+
+	expected := `<update>` +
+		`<add><doc><field name="id">1</field><field name="int_1" update="set">11</field></doc></add>` +
+		`<add><doc><field name="id">2</field><field name="int_1">20</field><field name="str_1">b</field></doc></add>` +
+		`<delete><id>3</id><id>4</id></delete>` +
+		`<delete><query>str_1:&lt;x&gt;</query><query>int_1:0</query></delete>` +
+		`</update>`
+	got, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Fatalf("\nexpected: %v\n but got: %v", expected, got)
+	}
+	if err := xml.NewDecoder(strings.NewReader(got)).Decode(new(struct{})); err != nil {
+		t.Fatalf("invalid xml: %v", err)
+	}
+
+	expectedBatches := []string{
+		`<update><add><doc><field name="id">1</field><field name="int_1" update="set">11</field></doc></add></update>`,
+		`<update><add><doc><field name="id">2</field><field name="int_1">20</field><field name="str_1">b</field></doc></add></update>`,
+		`<update><delete><id>3</id><id>4</id></delete><delete><query>str_1:&lt;x&gt;</query><query>int_1:0</query></delete></update>`,
+	}
+	batches := make([]string, 0)
+	for body, err := range builder.Batches(solr.BatchLimit{MaxBytes: 130}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, body)
+	}
+	if diff := cmp.Diff(expectedBatches, batches); diff != "" {
+		t.Fatalf("(-expected, +got)\n%s", diff)
+	}
+}
+
+func TestXMLEncoder_EncodeDeleteQuery(t *testing.T) {
+	if _, err := (solr.XMLEncoder{}).EncodeDeleteQuery(solr.DeleteQuery{Query: "*:*", Route: "a!"}); err == nil {
+		t.Fatal("expected error for _route_")
+	}
+	if _, err := (solr.XMLEncoder{}).EncodeDeleteQuery(solr.DeleteQuery{Query: "*:*", Version: 1}); err == nil {
+		t.Fatal("expected error for _version_")
+	}
+}